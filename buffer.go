@@ -11,27 +11,42 @@ import (
 
 type (
 	// DoubleBuffer is a samples buffer for VST ProcessDouble function.
+	// Samples are stored in C memory, channel after channel, so the plugin
+	// processes them in place. Frames can be reduced to get a shorter view
+	// of the same buffer.
 	DoubleBuffer struct {
 		Frames int
 		data   []*C.double
+		// mem holds channel pointers followed by samples. It's nil if
+		// buffer doesn't own the memory.
+		mem unsafe.Pointer
 	}
 
 	// FloatBuffer is a samples buffer for VST ProcessFloat function.
+	// Samples are stored in C memory, channel after channel, so the plugin
+	// processes them in place. Frames can be reduced to get a shorter view
+	// of the same buffer.
 	FloatBuffer struct {
 		Frames int
 		data   []*C.float
+		// mem holds channel pointers followed by samples. It's nil if
+		// buffer doesn't own the memory.
+		mem unsafe.Pointer
 	}
 )
 
-// NewDoubleBuffer allocates new memory for C-compatible buffer.
+// NewDoubleBuffer allocates new memory for C-compatible buffer. Channel
+// pointers and samples of all channels are stored in a single allocation.
 func NewDoubleBuffer(numChannels, frames int) DoubleBuffer {
-	b := make([]*C.double, numChannels)
-	for i := 0; i < numChannels; i++ {
-		b[i] = (*C.double)(C.calloc(1, C.size_t(C.sizeof_double*frames)))
+	mem := allocate(numChannels, frames, C.sizeof_double)
+	data := (*[1 << 28]*C.double)(mem)[:numChannels:numChannels]
+	for i := range data {
+		data[i] = (*C.double)(unsafe.Pointer(uintptr(mem) + sampleOffset(numChannels, frames, i, C.sizeof_double)))
 	}
 	return DoubleBuffer{
-		data:   b,
+		data:   data,
 		Frames: frames,
+		mem:    mem,
 	}
 }
 
@@ -42,12 +57,8 @@ func (b DoubleBuffer) Read(s signal.Floating) int {
 	// determine the size of data by picking up a lesser dimensions.
 	frames := min(s.Length(), b.Frames)
 
-	// copy data.
-	for c := 0; c < s.Channels(); c++ {
-		row := (*[1 << 30]C.double)(unsafe.Pointer(b.data[c]))
-		for i := 0; i < frames; i++ {
-			s.SetSample(s.BufferIndex(c, i), float64(row[i]))
-		}
+	for c := range b.data {
+		writeChannel(s, c, 0, b.Channel(c)[:frames])
 	}
 	return frames
 }
@@ -59,19 +70,18 @@ func (b DoubleBuffer) Write(s signal.Floating) int {
 	// determine the size of data by picking up a lesser dimensions.
 	frames := min(s.Length(), b.Frames)
 
-	// copy data.
-	for c := 0; c < s.Channels(); c++ {
-		row := (*[1 << 30]C.double)(unsafe.Pointer(b.data[c]))
-		for i := 0; i < frames; i++ {
-			row[i] = C.double(s.Sample(s.BufferIndex(c, i)))
-		}
+	for c := range b.data {
+		readChannel(s, c, 0, b.Channel(c)[:frames])
 	}
 	return frames
 }
 
 // cArray returns C array that is used as storage for buffer.
 func (b DoubleBuffer) cArray() **C.double {
-	return (**C.double)(unsafe.Pointer(&b.data[0]))
+	if len(b.data) == 0 {
+		return nil
+	}
+	return &b.data[0]
 }
 
 // Channel returns slice that's backed by C array and stores samples from
@@ -82,20 +92,21 @@ func (b DoubleBuffer) Channel(i int) []float64 {
 
 // Free the allocated memory.
 func (b DoubleBuffer) Free() {
-	for i := range b.data {
-		C.free(unsafe.Pointer(b.data[i]))
-	}
+	C.free(b.mem)
 }
 
-// NewFloatBuffer allocates new memory for C-compatible buffer.
+// NewFloatBuffer allocates new memory for C-compatible buffer. Channel
+// pointers and samples of all channels are stored in a single allocation.
 func NewFloatBuffer(numChannels, frames int) FloatBuffer {
-	b := make([]*C.float, numChannels)
-	for i := 0; i < numChannels; i++ {
-		b[i] = (*C.float)(C.calloc(1, C.size_t(C.sizeof_float*frames)))
+	mem := allocate(numChannels, frames, C.sizeof_float)
+	data := (*[1 << 28]*C.float)(mem)[:numChannels:numChannels]
+	for i := range data {
+		data[i] = (*C.float)(unsafe.Pointer(uintptr(mem) + sampleOffset(numChannels, frames, i, C.sizeof_float)))
 	}
 	return FloatBuffer{
-		data:   b,
+		data:   data,
 		Frames: frames,
+		mem:    mem,
 	}
 }
 
@@ -106,12 +117,8 @@ func (b FloatBuffer) Read(s signal.Floating) int {
 	// determine the size of data by picking up a lesser dimensions.
 	frames := min(s.Length(), b.Frames)
 
-	// copy data.
-	for c := 0; c < s.Channels(); c++ {
-		row := (*[1 << 30]C.float)(unsafe.Pointer(b.data[c]))
-		for i := 0; i < frames; i++ {
-			s.SetSample(s.BufferIndex(c, i), float64(row[i]))
-		}
+	for c := range b.data {
+		writeFloatChannel(s, c, b.Channel(c)[:frames])
 	}
 	return frames
 }
@@ -123,19 +130,18 @@ func (b FloatBuffer) Write(s signal.Floating) int {
 	// determine the size of data by picking up a lesser dimensions.
 	frames := min(s.Length(), b.Frames)
 
-	// copy data.
-	for c := 0; c < s.Channels(); c++ {
-		row := (*[1 << 30]C.float)(unsafe.Pointer(b.data[c]))
-		for i := 0; i < frames; i++ {
-			row[i] = C.float(s.Sample(s.BufferIndex(c, i)))
-		}
+	for c := range b.data {
+		readFloatChannel(s, c, b.Channel(c)[:frames])
 	}
 	return frames
 }
 
 // cArray returns C array that is used as storage for buffer.
 func (b FloatBuffer) cArray() **C.float {
-	return (**C.float)(unsafe.Pointer(&b.data[0]))
+	if len(b.data) == 0 {
+		return nil
+	}
+	return &b.data[0]
 }
 
 // Channel returns slice that's backed by C array and stores samples from
@@ -146,8 +152,301 @@ func (b FloatBuffer) Channel(i int) []float32 {
 
 // Free the allocated memory.
 func (b FloatBuffer) Free() {
-	for _, c := range b.data {
-		C.free(unsafe.Pointer(c))
+	C.free(b.mem)
+}
+
+// Floating returns signal.Floating that reads and writes samples of the
+// buffer directly. Samples of the signal are not interleaved: channels
+// follow each other, so BufferIndex(c, i) is c*Length()+i. The signal
+// can't be appended and must not be used after the buffer is freed.
+func (b DoubleBuffer) Floating() signal.Floating {
+	return doubleSignal{buffer: b, length: b.Frames}
+}
+
+// Floating returns signal.Floating that reads and writes samples of the
+// buffer directly. Samples are converted to float64 on access. See
+// DoubleBuffer.Floating for the layout.
+func (b FloatBuffer) Floating() signal.Floating {
+	return floatSignal{buffer: b, length: b.Frames}
+}
+
+// doubleSignal is a view of the DoubleBuffer frames [offset:offset+length].
+type doubleSignal struct {
+	buffer DoubleBuffer
+	offset int
+	length int
+}
+
+// channel returns samples of the channel that belong to the view.
+func (s doubleSignal) channel(c int) []float64 {
+	return s.buffer.Channel(c)[s.offset : s.offset+s.length]
+}
+
+func (s doubleSignal) Channels() int {
+	return len(s.buffer.data)
+}
+
+func (s doubleSignal) Capacity() int {
+	return s.buffer.Frames - s.offset
+}
+
+func (s doubleSignal) Length() int {
+	return s.length
+}
+
+func (s doubleSignal) Cap() int {
+	return s.Capacity() * s.Channels()
+}
+
+func (s doubleSignal) Len() int {
+	return s.length * s.Channels()
+}
+
+func (s doubleSignal) BufferIndex(channel, index int) int {
+	return channel*s.length + index
+}
+
+func (s doubleSignal) Sample(index int) float64 {
+	return s.channel(index / s.length)[index%s.length]
+}
+
+func (s doubleSignal) SetSample(index int, value float64) {
+	s.channel(index / s.length)[index%s.length] = value
+}
+
+// Slice returns the view of [start:end] frames. End can't exceed the
+// buffer frames.
+func (s doubleSignal) Slice(start, end int) signal.Floating {
+	if start < 0 || start > end || end > s.Capacity() {
+		panic("slice bounds out of range")
+	}
+	s.offset, s.length = s.offset+start, end-start
+	return s
+}
+
+func (s doubleSignal) Channel(c int) signal.Floating {
+	s.buffer.data = s.buffer.data[c : c+1]
+	return s
+}
+
+func (s doubleSignal) Append(signal.Floating) {
+	panic("buffer signal can't be appended")
+}
+
+func (s doubleSignal) AppendSample(float64) {
+	panic("buffer signal can't be appended")
+}
+
+// Free does nothing, the memory is owned by the buffer.
+func (s doubleSignal) Free(*signal.PoolAllocator) {}
+
+// floatSignal is a view of the FloatBuffer frames [offset:offset+length].
+type floatSignal struct {
+	buffer FloatBuffer
+	offset int
+	length int
+}
+
+// channel returns samples of the channel that belong to the view.
+func (s floatSignal) channel(c int) []float32 {
+	return s.buffer.Channel(c)[s.offset : s.offset+s.length]
+}
+
+func (s floatSignal) Channels() int {
+	return len(s.buffer.data)
+}
+
+func (s floatSignal) Capacity() int {
+	return s.buffer.Frames - s.offset
+}
+
+func (s floatSignal) Length() int {
+	return s.length
+}
+
+func (s floatSignal) Cap() int {
+	return s.Capacity() * s.Channels()
+}
+
+func (s floatSignal) Len() int {
+	return s.length * s.Channels()
+}
+
+func (s floatSignal) BufferIndex(channel, index int) int {
+	return channel*s.length + index
+}
+
+func (s floatSignal) Sample(index int) float64 {
+	return float64(s.channel(index / s.length)[index%s.length])
+}
+
+func (s floatSignal) SetSample(index int, value float64) {
+	s.channel(index / s.length)[index%s.length] = float32(value)
+}
+
+// Slice returns the view of [start:end] frames. End can't exceed the
+// buffer frames.
+func (s floatSignal) Slice(start, end int) signal.Floating {
+	if start < 0 || start > end || end > s.Capacity() {
+		panic("slice bounds out of range")
+	}
+	s.offset, s.length = s.offset+start, end-start
+	return s
+}
+
+func (s floatSignal) Channel(c int) signal.Floating {
+	s.buffer.data = s.buffer.data[c : c+1]
+	return s
+}
+
+func (s floatSignal) Append(signal.Floating) {
+	panic("buffer signal can't be appended")
+}
+
+func (s floatSignal) AppendSample(float64) {
+	panic("buffer signal can't be appended")
+}
+
+// Free does nothing, the memory is owned by the buffer.
+func (s floatSignal) Free(*signal.PoolAllocator) {}
+
+// growDoubleBuffer returns buffer that fits provided dimensions. If
+// provided buffer doesn't fit, it's freed and the new one is allocated.
+func growDoubleBuffer(b DoubleBuffer, numChannels, frames int) DoubleBuffer {
+	if b.mem != nil && len(b.data) == numChannels && b.Frames >= frames {
+		return b
+	}
+	b.Free()
+	return NewDoubleBuffer(numChannels, frames)
+}
+
+// growFloatBuffer returns buffer that fits provided dimensions. If
+// provided buffer doesn't fit, it's freed and the new one is allocated.
+func growFloatBuffer(b FloatBuffer, numChannels, frames int) FloatBuffer {
+	if b.mem != nil && len(b.data) == numChannels && b.Frames >= frames {
+		return b
+	}
+	b.Free()
+	return NewFloatBuffer(numChannels, frames)
+}
+
+// convertToFloat copies samples from double to float buffer.
+func convertToFloat(src DoubleBuffer, dst FloatBuffer) {
+	for c := range src.data {
+		in, out := src.Channel(c), dst.Channel(c)
+		for i := range out {
+			out[i] = float32(in[i])
+		}
+	}
+}
+
+// convertToDouble copies samples from float to double buffer.
+func convertToDouble(src FloatBuffer, dst DoubleBuffer) {
+	for c := range src.data {
+		in, out := src.Channel(c), dst.Channel(c)
+		for i := range out {
+			out[i] = float64(in[i])
+		}
+	}
+}
+
+// allocate returns zeroed C memory for channel pointers and samples. At
+// least one byte is allocated, so the pointer is never nil.
+func allocate(numChannels, frames int, sampleSize C.size_t) unsafe.Pointer {
+	size := sampleOffset(numChannels, frames, numChannels, sampleSize)
+	if size == 0 {
+		size = 1
+	}
+	return C.calloc(1, C.size_t(size))
+}
+
+// sampleOffset returns offset of channel samples in the buffer memory.
+func sampleOffset(numChannels, frames, channel int, sampleSize C.size_t) uintptr {
+	return uintptr(numChannels)*unsafe.Sizeof(uintptr(0)) + uintptr(channel*frames)*uintptr(sampleSize)
+}
+
+// channelIndex returns the buffer index of the channel sample and the
+// distance between adjacent samples of the channel.
+func channelIndex(s signal.Floating, channel, index int) (int, int) {
+	idx := s.BufferIndex(channel, index)
+	return idx, s.BufferIndex(channel, index+1) - idx
+}
+
+// readChannel copies samples of the signal channel, starting from provided
+// index, into dst.
+func readChannel(s signal.Floating, channel, index int, dst []float64) {
+	switch v := s.(type) {
+	case doubleSignal:
+		copy(dst, v.channel(channel)[index:])
+	case floatSignal:
+		src := v.channel(channel)[index:]
+		for i := range dst {
+			dst[i] = float64(src[i])
+		}
+	default:
+		idx, stride := channelIndex(s, channel, index)
+		for i := range dst {
+			dst[i] = s.Sample(idx)
+			idx += stride
+		}
+	}
+}
+
+// writeChannel copies src into the signal channel, starting from provided
+// index.
+func writeChannel(s signal.Floating, channel, index int, src []float64) {
+	switch v := s.(type) {
+	case doubleSignal:
+		copy(v.channel(channel)[index:], src)
+	case floatSignal:
+		dst := v.channel(channel)[index:]
+		for i, f := range src {
+			dst[i] = float32(f)
+		}
+	default:
+		idx, stride := channelIndex(s, channel, index)
+		for _, f := range src {
+			s.SetSample(idx, f)
+			idx += stride
+		}
+	}
+}
+
+// readFloatChannel copies samples of the signal channel into dst.
+func readFloatChannel(s signal.Floating, channel int, dst []float32) {
+	switch v := s.(type) {
+	case floatSignal:
+		copy(dst, v.channel(channel))
+	case doubleSignal:
+		src := v.channel(channel)
+		for i := range dst {
+			dst[i] = float32(src[i])
+		}
+	default:
+		idx, stride := channelIndex(s, channel, 0)
+		for i := range dst {
+			dst[i] = float32(s.Sample(idx))
+			idx += stride
+		}
+	}
+}
+
+// writeFloatChannel copies src into the signal channel.
+func writeFloatChannel(s signal.Floating, channel int, src []float32) {
+	switch v := s.(type) {
+	case floatSignal:
+		copy(v.channel(channel), src)
+	case doubleSignal:
+		dst := v.channel(channel)
+		for i, f := range src {
+			dst[i] = float64(f)
+		}
+	default:
+		idx, stride := channelIndex(s, channel, 0)
+		for _, f := range src {
+			s.SetSample(idx, float64(f))
+			idx += stride
+		}
 	}
 }
 
@@ -165,6 +464,13 @@ func getFloatChannel(buf **C.float, i int) *C.float {
 	return *ptrPtr
 }
 
+// zero sets all samples to zero.
+func zero(s []float64) {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -134,3 +134,104 @@ func assertEqual(t *testing.T, name string, result, expected interface{}) {
 		t.Fatalf("%v\nresult: \t%T\t%+v \nexpected: \t%T\t%+v", name, result, result, expected, expected)
 	}
 }
+
+func TestBufferFloating(t *testing.T) {
+	t.Parallel()
+	b := NewDoubleBuffer(2, 4)
+	defer b.Free()
+	f := NewFloatBuffer(2, 4)
+	defer f.Free()
+	for _, s := range []signal.Floating{b.Floating(), f.Floating()} {
+		assertEqual(t, "channels", s.Channels(), 2)
+		assertEqual(t, "length", s.Length(), 4)
+		assertEqual(t, "len", s.Len(), 8)
+		assertEqual(t, "buffer index", s.BufferIndex(1, 2), 6)
+		signal.WriteFloat64([]float64{1, 2, 3, 4, 5, 6, 7, 8}, s)
+
+		sliced := s.Slice(1, 3)
+		assertEqual(t, "sliced length", sliced.Length(), 2)
+		assertEqual(t, "sliced capacity", sliced.Capacity(), 3)
+		assertEqual(t, "sliced sample", sliced.Sample(sliced.BufferIndex(1, 0)), 6.0)
+
+		channel := sliced.Channel(1)
+		assertEqual(t, "channel channels", channel.Channels(), 1)
+		channel.SetSample(channel.BufferIndex(0, 1), 10)
+		assertEqual(t, "channel sample", s.Sample(s.BufferIndex(1, 2)), 10.0)
+	}
+	assertEqual(t, "double storage", b.Channel(1), []float64{5, 6, 10, 8})
+	assertEqual(t, "float storage", f.Channel(1), []float32{5, 6, 10, 8})
+
+	// views are copied by channels.
+	d := NewDoubleBuffer(2, 4)
+	defer d.Free()
+	d.Write(f.Floating())
+	assertEqual(t, "float to double", d.Channel(1), []float64{5, 6, 10, 8})
+	f.Write(b.Floating().Slice(2, 4))
+	assertEqual(t, "double to float", f.Channel(0), []float32{3, 4, 3, 4})
+	d.Read(b.Floating())
+	assertEqual(t, "read double", b.Channel(0), []float64{1, 2, 3, 4})
+}
+
+const (
+	benchmarkChannels = 32
+	benchmarkFrames   = 64
+)
+
+func benchmarkSignal() signal.Floating {
+	s := signal.Allocator{
+		Channels: benchmarkChannels,
+		Length:   benchmarkFrames,
+		Capacity: benchmarkFrames,
+	}.Float64()
+	for i := 0; i < s.Len(); i++ {
+		s.SetSample(i, float64(i))
+	}
+	return s
+}
+
+// BenchmarkBufferPerSample copies samples the way buffers did before
+// channel copies: index is computed on every sample.
+func BenchmarkBufferPerSample(b *testing.B) {
+	s := benchmarkSignal()
+	buf := NewDoubleBuffer(benchmarkChannels, benchmarkFrames)
+	defer buf.Free()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for c := 0; c < s.Channels(); c++ {
+			row := buf.Channel(c)
+			for i := range row {
+				row[i] = s.Sample(s.BufferIndex(c, i))
+			}
+		}
+		for c := 0; c < s.Channels(); c++ {
+			row := buf.Channel(c)
+			for i := range row {
+				s.SetSample(s.BufferIndex(c, i), row[i])
+			}
+		}
+	}
+}
+
+func BenchmarkBufferWriteRead(b *testing.B) {
+	s := benchmarkSignal()
+	buf := NewDoubleBuffer(benchmarkChannels, benchmarkFrames)
+	defer buf.Free()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		buf.Write(s)
+		buf.Read(s)
+	}
+}
+
+func BenchmarkBufferFloating(b *testing.B) {
+	buf := NewDoubleBuffer(benchmarkChannels, benchmarkFrames)
+	defer buf.Free()
+	view := NewDoubleBuffer(benchmarkChannels, benchmarkFrames)
+	defer view.Free()
+	s := view.Floating()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		buf.Write(s)
+		buf.Read(s)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Bus is a group of plugin pins that carry a single signal: a stereo
+	// pair or a mono pin.
+	Bus struct {
+		// Index is the position of bus among plugin input or output
+		// buses.
+		Index int
+		// Label and ShortLabel are taken from the properties of the
+		// first pin. Generated label is used if plugin doesn't provide
+		// properties.
+		Label      string
+		ShortLabel string
+		// Pins holds indices of plugin inputs or outputs.
+		Pins []int
+		// Arrangement is the speaker arrangement of the bus. It's only
+		// valid if plugin sets PinUseSpeaker flag.
+		Arrangement SpeakerArrangementType
+	}
+
+	// BusFunc selects the bus from the plugin buses.
+	BusFunc func(buses []Bus) (Bus, error)
+)
+
+// Stereo returns true if bus is a stereo pair.
+func (b Bus) Stereo() bool {
+	return len(b.Pins) == 2
+}
+
+// InputBuses returns the plugin inputs grouped into buses according to
+// pin properties. If plugin doesn't provide properties, inputs are paired
+// into stereo buses.
+func (p *Plugin) InputBuses() []Bus {
+	return buses("Input", p.NumInputs(), p.GetInputProperties)
+}
+
+// OutputBuses returns the plugin outputs grouped into buses according to
+// pin properties. If plugin doesn't provide properties, outputs are paired
+// into stereo buses.
+func (p *Plugin) OutputBuses() []Bus {
+	return buses("Output", p.NumOutputs(), p.GetOutputProperties)
+}
+
+func buses(prefix string, pins int, propsFn func(int) (*PinProperties, bool)) []Bus {
+	var result []Bus
+	for pin := 0; pin < pins; {
+		bus := Bus{
+			Index: len(result),
+			Label: fmt.Sprintf("%s %d", prefix, len(result)+1),
+		}
+		props, ok := propsFn(pin)
+		stereo := pin+1 < pins
+		if ok {
+			stereo = stereo && props.Flags&PinIsStereo != 0
+			if label := props.Label.String(); label != "" {
+				bus.Label = label
+			}
+			bus.ShortLabel = props.ShortLabel.String()
+			if props.Flags&PinUseSpeaker != 0 {
+				bus.Arrangement = props.SpeakerArrangementType
+			}
+		}
+		if stereo {
+			bus.Pins = []int{pin, pin + 1}
+		} else {
+			bus.Pins = []int{pin}
+		}
+		pin += len(bus.Pins)
+		result = append(result, bus)
+	}
+	return result
+}
+
+// SidechainBus selects the input bus labelled as sidechain. If there is no
+// such bus, the last bus is selected. The main bus is never selected.
+func SidechainBus(buses []Bus) (Bus, error) {
+	if len(buses) < 2 {
+		return Bus{}, fmt.Errorf("plugin has no sidechain bus")
+	}
+	for _, b := range buses[1:] {
+		label := strings.ToLower(b.Label + " " + b.ShortLabel)
+		if strings.Contains(label, "side") || strings.Contains(label, "s/c") {
+			return b, nil
+		}
+	}
+	return buses[len(buses)-1], nil
+}
+
+// StaticBus returns BusFunc that always selects the bus with provided
+// index.
+func StaticBus(index int) BusFunc {
+	return func(buses []Bus) (Bus, error) {
+		if index < 0 || index >= len(buses) {
+			return Bus{}, fmt.Errorf("bus %d doesn't exist, plugin has %d buses", index, len(buses))
+		}
+		return buses[index], nil
+	}
+}
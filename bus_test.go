@@ -0,0 +1,68 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import "testing"
+
+func TestBuses(t *testing.T) {
+	t.Parallel()
+	pin := func(label string, flags PinPropertiesFlag) PinProperties {
+		var props PinProperties
+		copy(props.Label[:], label)
+		props.Flags = flags
+		return props
+	}
+	compressor := []PinProperties{
+		pin("Main L", PinIsStereo),
+		pin("Main R", 0),
+		pin("Sidechain L", PinIsStereo),
+		pin("Sidechain R", 0),
+		pin("Aux", 0),
+	}
+	propsFn := func(props []PinProperties) func(int) (*PinProperties, bool) {
+		return func(i int) (*PinProperties, bool) {
+			if props == nil {
+				return nil, false
+			}
+			return &props[i], true
+		}
+	}
+
+	result := buses("Input", len(compressor), propsFn(compressor))
+	assertEqual(t, "buses", len(result), 3)
+	assertEqual(t, "main", result[0].Pins, []int{0, 1})
+	assertEqual(t, "main label", result[0].Label, "Main L")
+	assertEqual(t, "sidechain", result[1].Pins, []int{2, 3})
+	assertEqual(t, "aux", result[2].Pins, []int{4})
+	assertEqual(t, "aux stereo", result[2].Stereo(), false)
+
+	sidechain, err := SidechainBus(result)
+	assertEqual(t, "sidechain error", err, nil)
+	assertEqual(t, "sidechain bus", sidechain.Index, 1)
+
+	result = buses("Input", 3, propsFn(nil))
+	assertEqual(t, "buses without properties", len(result), 2)
+	assertEqual(t, "stereo pair", result[0].Pins, []int{0, 1})
+	assertEqual(t, "generated label", result[1].Label, "Input 2")
+	sidechain, err = SidechainBus(result)
+	assertEqual(t, "last bus error", err, nil)
+	assertEqual(t, "last bus", sidechain.Index, 1)
+
+	_, err = SidechainBus(result[:1])
+	assertEqual(t, "single bus", err != nil, true)
+	_, err = StaticBus(2)(result)
+	assertEqual(t, "static bus out of range", err != nil, true)
+}
+
+func TestStemNames(t *testing.T) {
+	t.Parallel()
+	result := stemNames([]Bus{
+		{Index: 0, Label: "Kick L", Pins: []int{0, 1}},
+		{Index: 1, Label: "Snare", Pins: []int{2, 3}},
+		{Index: 2, ShortLabel: "Tom", Pins: []int{4}},
+		{Index: 3, Pins: []int{5}},
+		{Index: 4, Label: "Snare", Pins: []int{6}},
+	})
+	assertEqual(t, "names", result, []string{"Kick", "Snare", "Tom", "Output 4", "Snare 2"})
+}
@@ -0,0 +1,51 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestCallbacks(t *testing.T) {
+	callback := func(result int64) HostCallbackFunc {
+		return func(HostOpcode, int32, int64, unsafe.Pointer, float32) int64 {
+			return result
+		}
+	}
+	first := registerCallback(callback(1))
+	second := registerCallback(callback(2))
+	assertEqual(t, "first", lookupCallback(first)(HostIdle, 0, 0, nil, 0), int64(1))
+	assertEqual(t, "second", lookupCallback(second)(HostIdle, 0, 0, nil, 0), int64(2))
+	assertEqual(t, "unregistered", lookupCallback(0) == nil, true)
+
+	unregisterCallback(first)
+	assertEqual(t, "removed", lookupCallback(first) == nil, true)
+	// handle is reused.
+	third := registerCallback(callback(3))
+	assertEqual(t, "reused", third, first)
+	assertEqual(t, "third", lookupCallback(third)(HostIdle, 0, 0, nil, 0), int64(3))
+	unregisterCallback(second)
+	unregisterCallback(third)
+}
+
+func TestSupportCanDo(t *testing.T) {
+	t.Parallel()
+	h := Host{
+		CanDo: func(HostCanDoString) CanDoResponse {
+			return NoCanDo
+		},
+	}
+	query := func(h Host, s HostCanDoString) CanDoResponse {
+		cs := append([]byte(s), 0)
+		return CanDoResponse(h.Callback()(HostCanDo, 0, 0, unsafe.Pointer(&cs[0]), 0))
+	}
+	// plain host doesn't report capabilities on its own.
+	assertEqual(t, "host", query(h, HostCanStartStopProcess), NoCanDo)
+
+	h.CanDo = supportCanDo(h.CanDo, HostCanStartStopProcess)
+	assertEqual(t, "supported", query(h, HostCanStartStopProcess), YesCanDo)
+	assertEqual(t, "wrapped", query(h, HostCanOffline), NoCanDo)
+	assertEqual(t, "default", supportCanDo(nil)(HostCanOffline), MaybeCanDo)
+}
@@ -0,0 +1,142 @@
+package vst2
+
+import "fmt"
+
+type (
+	// ChannelMap routes channels between the pipe line and plugin I/O.
+	ChannelMap struct {
+		// Inputs holds the line channel for every plugin input. Negative
+		// value means that plugin input is not connected.
+		Inputs []int
+		// Outputs holds the plugin outputs for every line channel
+		// produced by processor. If multiple plugin outputs are routed
+		// into the same line channel, their average is taken.
+		Outputs [][]int
+	}
+
+	// ChannelMapFunc returns the channel map for provided number of line
+	// channels, plugin inputs and plugin outputs.
+	ChannelMapFunc func(channels, inputs, outputs int) (ChannelMap, error)
+)
+
+// IdentityChannels routes every line channel to the plugin input with the
+// same index. Plugin inputs without matching line channel are not
+// connected. Every plugin output produces a line channel.
+func IdentityChannels(channels, inputs, outputs int) (ChannelMap, error) {
+	m := ChannelMap{
+		Inputs:  make([]int, inputs),
+		Outputs: make([][]int, outputs),
+	}
+	for i := range m.Inputs {
+		m.Inputs[i] = -1
+		if i < channels {
+			m.Inputs[i] = i
+		}
+	}
+	for i := range m.Outputs {
+		m.Outputs[i] = []int{i}
+	}
+	return m, nil
+}
+
+// MonoToStereo feeds the mono line into every plugin input. Every plugin
+// output produces a line channel.
+func MonoToStereo(channels, inputs, outputs int) (ChannelMap, error) {
+	if channels != 1 {
+		return ChannelMap{}, fmt.Errorf("mono to stereo: expected mono line, got %d channels", channels)
+	}
+	m, _ := IdentityChannels(channels, inputs, outputs)
+	for i := range m.Inputs {
+		m.Inputs[i] = 0
+	}
+	return m, nil
+}
+
+// StereoToMono routes the line channels to the plugin inputs with the same
+// index and mixes the first two plugin outputs into a mono line.
+func StereoToMono(channels, inputs, outputs int) (ChannelMap, error) {
+	if outputs < 2 {
+		return ChannelMap{}, fmt.Errorf("stereo to mono: expected stereo plugin output, got %d outputs", outputs)
+	}
+	m, _ := IdentityChannels(channels, inputs, outputs)
+	m.Outputs = [][]int{{0, 1}}
+	return m, nil
+}
+
+// StaticChannels returns ChannelMapFunc that always uses provided map.
+func StaticChannels(m ChannelMap) ChannelMapFunc {
+	return func(int, int, int) (ChannelMap, error) {
+		return m, nil
+	}
+}
+
+// validate checks that channel map is applicable. If zeroFill is false,
+// every plugin input must be connected. External inputs are fed from
+// outside of the line and must not be connected.
+func (m ChannelMap) validate(channels, inputs, outputs int, zeroFill bool, external ...int) error {
+	if len(m.Inputs) != inputs {
+		return fmt.Errorf("channel map has %d inputs, plugin has %d", len(m.Inputs), inputs)
+	}
+	for i, c := range m.Inputs {
+		if c >= channels {
+			return fmt.Errorf("plugin input %d is mapped to line channel %d, line has %d channels", i, c, channels)
+		}
+		if c < 0 && !zeroFill && !contains(external, i) {
+			return fmt.Errorf("plugin input %d is not connected", i)
+		}
+	}
+	if len(m.Outputs) == 0 {
+		return fmt.Errorf("channel map has no outputs")
+	}
+	for c, outs := range m.Outputs {
+		for _, o := range outs {
+			if o < 0 || o >= outputs {
+				return fmt.Errorf("line channel %d is mapped to plugin output %d, plugin has %d outputs", c, o, outputs)
+			}
+		}
+	}
+	return nil
+}
+
+// dryInputs returns the plugin input that provides the dry signal of every
+// plugin output. Output takes the input fed by the same line channel.
+// Other outputs take connected inputs in turn, so mono input is duplicated
+// to all outputs. Negative value means that output has no dry signal.
+func (m ChannelMap) dryInputs(outputs int) []int {
+	var connected []int
+	for i, c := range m.Inputs {
+		if c >= 0 {
+			connected = append(connected, i)
+		}
+	}
+	dry := make([]int, outputs)
+	for o := range dry {
+		dry[o] = -1
+		if len(connected) > 0 {
+			dry[o] = connected[o%len(connected)]
+		}
+	}
+	for c, outs := range m.Outputs {
+		for i, in := range m.Inputs {
+			if in != c {
+				continue
+			}
+			for _, o := range outs {
+				if o >= 0 && o < outputs {
+					dry[o] = i
+				}
+			}
+			break
+		}
+	}
+	return dry
+}
+
+func contains(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
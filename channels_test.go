@@ -0,0 +1,107 @@
+package vst2
+
+import "testing"
+
+func TestChannelMap(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		fn       ChannelMapFunc
+		channels int
+		inputs   int
+		outputs  int
+		zeroFill bool
+		external []int
+		expected ChannelMap
+		invalid  bool
+	}{
+		{
+			name:     "identity",
+			fn:       IdentityChannels,
+			channels: 2,
+			inputs:   2,
+			outputs:  2,
+			expected: ChannelMap{Inputs: []int{0, 1}, Outputs: [][]int{{0}, {1}}},
+		},
+		{
+			name:     "identity with sidechain",
+			fn:       IdentityChannels,
+			channels: 2,
+			inputs:   4,
+			outputs:  2,
+			zeroFill: true,
+			expected: ChannelMap{Inputs: []int{0, 1, -1, -1}, Outputs: [][]int{{0}, {1}}},
+		},
+		{
+			name:     "identity with external sidechain",
+			fn:       IdentityChannels,
+			channels: 2,
+			inputs:   4,
+			outputs:  2,
+			external: []int{2, 3},
+			expected: ChannelMap{Inputs: []int{0, 1, -1, -1}, Outputs: [][]int{{0}, {1}}},
+		},
+		{
+			name:     "identity without zero fill",
+			fn:       IdentityChannels,
+			channels: 1,
+			inputs:   2,
+			outputs:  2,
+			expected: ChannelMap{Inputs: []int{0, -1}, Outputs: [][]int{{0}, {1}}},
+			invalid:  true,
+		},
+		{
+			name:     "mono to stereo",
+			fn:       MonoToStereo,
+			channels: 1,
+			inputs:   2,
+			outputs:  2,
+			expected: ChannelMap{Inputs: []int{0, 0}, Outputs: [][]int{{0}, {1}}},
+		},
+		{
+			name:     "stereo to mono",
+			fn:       StereoToMono,
+			channels: 2,
+			inputs:   2,
+			outputs:  2,
+			expected: ChannelMap{Inputs: []int{0, 1}, Outputs: [][]int{{0, 1}}},
+		},
+		{
+			name:     "static out of range",
+			fn:       StaticChannels(ChannelMap{Inputs: []int{0, 2}, Outputs: [][]int{{0}}}),
+			channels: 2,
+			inputs:   2,
+			outputs:  2,
+			expected: ChannelMap{Inputs: []int{0, 2}, Outputs: [][]int{{0}}},
+			invalid:  true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			m, err := test.fn(test.channels, test.inputs, test.outputs)
+			assertEqual(t, "map error", err, nil)
+			assertEqual(t, "channel map", m, test.expected)
+			err = m.validate(test.channels, test.inputs, test.outputs, test.zeroFill, test.external...)
+			assertEqual(t, "invalid", err != nil, test.invalid)
+		})
+	}
+
+	_, err := MonoToStereo(2, 2, 2)
+	assertEqual(t, "mono to stereo error", err != nil, true)
+	_, err = StereoToMono(2, 2, 1)
+	assertEqual(t, "stereo to mono error", err != nil, true)
+}
+
+func TestDryInputs(t *testing.T) {
+	t.Parallel()
+	identity, _ := IdentityChannels(1, 1, 2)
+	assertEqual(t, "mono input", identity.dryInputs(2), []int{0, 0})
+	identity, _ = IdentityChannels(2, 2, 2)
+	assertEqual(t, "stereo", identity.dryInputs(2), []int{0, 1})
+	swapped := ChannelMap{Inputs: []int{0, 1}, Outputs: [][]int{{1}, {0}}}
+	assertEqual(t, "swapped outputs", swapped.dryInputs(2), []int{1, 0})
+	sidechain := ChannelMap{Inputs: []int{-1, -1}, Outputs: [][]int{{0}}}
+	assertEqual(t, "not connected", sidechain.dryInputs(1), []int{-1})
+}
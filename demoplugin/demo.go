@@ -55,7 +55,13 @@ func init() {
 					}
 				}
 			},
-		}, vst2.Dispatcher{}
+		}, vst2.Dispatcher{
+			// received events are sent back to the host, so tests
+			// can check what plugin receives.
+			ProcessEventsFunc: func(events *vst2.EventsPtr) {
+				h.ProcessEvents(events)
+			},
+		}
 	}
 }
 
@@ -31,23 +31,17 @@ const (
 // EventsPtr is a container for events to be processed by plugin or host.
 type EventsPtr C.Events
 
-// Events allocates new events container and place there provided events.
-// It must be freed after use.
+// Events allocates new events container and place there copies of
+// provided events. It must be freed after use.
 func Events(events ...Event) *EventsPtr {
-	CEvents := C.newEvents(C.int32_t(len(events)))
-	for i := range events {
-		switch e := events[i].(type) {
-		case *MIDIEvent:
-			e.eventType = MIDI
-			e.byteSize = midiEventSize
-			C.setEvent(CEvents, unsafe.Pointer(e), C.int32_t(i))
-		case *SysExMIDIEvent:
-			e.eventType = SysExMIDI
-			e.byteSize = sysExEventSize
-			C.setEvent(CEvents, unsafe.Pointer(e), C.int32_t(i))
-		}
+	b := EventsBuffer{
+		events:   newEventsBuffer(len(events)),
+		capacity: len(events),
+	}
+	for _, e := range events {
+		b.Append(e)
 	}
-	return (*EventsPtr)(CEvents)
+	return b.Events()
 }
 
 // NumEvents returns number of events within container.
@@ -87,6 +81,60 @@ type Event interface {
 func (*MIDIEvent) sealedEvent()      {}
 func (*SysExMIDIEvent) sealedEvent() {}
 
+// TimedEvent is an event addressed by the absolute sample position in
+// the processed stream.
+type TimedEvent struct {
+	Position int64
+	Event    Event
+}
+
+// copyEvent returns a copy of the provided event. Nil is returned for
+// unknown event types.
+func copyEvent(e Event) Event {
+	switch e := e.(type) {
+	case *MIDIEvent:
+		c := *e
+		return &c
+	case *SysExMIDIEvent:
+		c := *e
+		return &c
+	}
+	return nil
+}
+
+// setDeltaFrames sets the position of the event within the processing
+// block.
+func setDeltaFrames(e Event, delta int32) {
+	switch e := e.(type) {
+	case *MIDIEvent:
+		e.DeltaFrames = delta
+	case *SysExMIDIEvent:
+		e.DeltaFrames = delta
+	}
+}
+
+// scaleDeltaFrames multiplies DeltaFrames of all events in container by
+// provided factor.
+func scaleDeltaFrames(events *EventsPtr, factor int32) {
+	for i := 0; i < events.NumEvents(); i++ {
+		if e := events.Event(i); e != nil {
+			setDeltaFrames(e, deltaFrames(e)*factor)
+		}
+	}
+}
+
+// deltaFrames returns the position of the event within the processing
+// block.
+func deltaFrames(e Event) int32 {
+	switch e := e.(type) {
+	case *MIDIEvent:
+		return e.DeltaFrames
+	case *SysExMIDIEvent:
+		return e.DeltaFrames
+	}
+	return 0
+}
+
 type (
 	// MIDIEvent contains midi information.
 	MIDIEvent struct {
@@ -151,3 +199,112 @@ func (s SysExDataPtr) Bytes() []byte {
 func (s SysExDataPtr) Free() {
 	C.free(unsafe.Pointer(s.data))
 }
+
+// EventsBuffer is a fixed-capacity events container that is allocated
+// once and reused. Events are copied into C memory, so no allocations
+// happen when events are appended. Zero value has zero capacity. It must
+// be freed after use.
+type EventsBuffer struct {
+	events   *C.Events
+	capacity int
+}
+
+// eventSlotSize fits any event type.
+var eventSlotSize = func() uintptr {
+	if s := unsafe.Sizeof(SysExMIDIEvent{}); s > unsafe.Sizeof(MIDIEvent{}) {
+		return s
+	}
+	return unsafe.Sizeof(MIDIEvent{})
+}()
+
+// NewEventsBuffer allocates events container with provided capacity.
+func NewEventsBuffer(capacity int) *EventsBuffer {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &EventsBuffer{
+		events:   newEventsBuffer(capacity),
+		capacity: capacity,
+	}
+}
+
+// newEventsBuffer allocates events container together with storage for
+// provided number of events.
+func newEventsBuffer(capacity int) *C.Events {
+	events := C.newEventsBuffer(C.int32_t(capacity), C.size_t(eventSlotSize))
+	if events == nil {
+		panic("failed to allocate events buffer")
+	}
+	return events
+}
+
+// Append places a copy of event into container. Returns false if
+// container is full or event type is unknown.
+func (b *EventsBuffer) Append(e Event) bool {
+	if b.events == nil {
+		return false
+	}
+	n := int(b.events.numEvents)
+	if n == b.capacity {
+		return false
+	}
+	slot := C.getEvent(b.events, C.int32_t(n))
+	switch e := e.(type) {
+	case *MIDIEvent:
+		m := (*MIDIEvent)(slot)
+		*m = *e
+		m.eventType, m.byteSize = MIDI, midiEventSize
+	case *SysExMIDIEvent:
+		m := (*SysExMIDIEvent)(slot)
+		*m = *e
+		m.eventType, m.byteSize = SysExMIDI, sysExEventSize
+	default:
+		return false
+	}
+	b.events.numEvents = C.int32_t(n + 1)
+	return true
+}
+
+// Reset removes all events from container.
+func (b *EventsBuffer) Reset() {
+	if b.events != nil {
+		b.events.numEvents = 0
+	}
+}
+
+// Len returns the number of events in container.
+func (b *EventsBuffer) Len() int {
+	if b.events == nil {
+		return 0
+	}
+	return int(b.events.numEvents)
+}
+
+// Cap returns the capacity of container.
+func (b *EventsBuffer) Cap() int {
+	return b.capacity
+}
+
+// Events returns the container to be sent to plugin. It's valid until the
+// buffer is reset or freed. Returns nil if buffer is not allocated.
+func (b *EventsBuffer) Events() *EventsPtr {
+	return (*EventsPtr)(b.events)
+}
+
+// reserve reallocates the container if it can't fit provided number of
+// events. Events are removed if container is reallocated.
+func (b *EventsBuffer) reserve(capacity int) {
+	if b.events != nil && b.capacity >= capacity {
+		return
+	}
+	C.free(unsafe.Pointer(b.events))
+	b.events, b.capacity = nil, 0
+	b.events = newEventsBuffer(capacity)
+	b.capacity = capacity
+}
+
+// Free releases allocated memory.
+func (b *EventsBuffer) Free() {
+	C.free(unsafe.Pointer(b.events))
+	b.events, b.capacity = nil, 0
+}
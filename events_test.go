@@ -32,6 +32,58 @@ func TestEvents(t *testing.T) {
 	}
 }
 
+func TestEventsCopy(t *testing.T) {
+	t.Parallel()
+	e := vst2.NewMIDIEvent(1, vst2.NoteOn{Key: 60, Velocity: 100})
+	events := vst2.Events(e)
+	defer events.Free()
+	e.DeltaFrames = 2
+	assertEqual(t, "delta", events.Event(0).(*vst2.MIDIEvent).DeltaFrames, int32(1))
+}
+
+func TestEventsBuffer(t *testing.T) {
+	dump := vst2.SysExData([]byte{0xF0, 0xF7})
+	defer dump.Free()
+	b := vst2.NewEventsBuffer(2)
+	defer b.Free()
+	assertEqual(t, "capacity", b.Cap(), 2)
+
+	note := vst2.NewMIDIEvent(3, vst2.NoteOn{Key: 60, Velocity: 100})
+	assertEqual(t, "append midi", b.Append(note), true)
+	assertEqual(t, "append sysex", b.Append(&vst2.SysExMIDIEvent{DeltaFrames: 5, SysExDump: dump}), true)
+	assertEqual(t, "append full", b.Append(&vst2.MIDIEvent{}), false)
+	note.DeltaFrames = 10
+
+	events := b.Events()
+	assertEqual(t, "num events", events.NumEvents(), 2)
+	assertEqual(t, "midi", events.Event(0).(*vst2.MIDIEvent).DeltaFrames, int32(3))
+	sysex := events.Event(1).(*vst2.SysExMIDIEvent)
+	assertEqual(t, "sysex delta", sysex.DeltaFrames, int32(5))
+	assertEqual(t, "sysex data", sysex.SysExDump.Bytes(), []byte{0xF0, 0xF7})
+
+	b.Reset()
+	assertEqual(t, "reset", b.Len(), 0)
+	assertEqual(t, "reset events", events.NumEvents(), 0)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		b.Reset()
+		b.Append(note)
+		b.Append(note)
+	})
+	assertEqual(t, "allocations", allocs, float64(0))
+}
+
+func TestEventsBufferZeroValue(t *testing.T) {
+	t.Parallel()
+	var b vst2.EventsBuffer
+	defer b.Free()
+	b.Reset()
+	assertEqual(t, "append", b.Append(&vst2.MIDIEvent{}), false)
+	assertEqual(t, "len", b.Len(), 0)
+	assertEqual(t, "cap", b.Cap(), 0)
+	assertEqual(t, "events", b.Events() == nil, true)
+}
+
 func assertEqual(t *testing.T, name string, result, expected interface{}) {
 	t.Helper()
 	if !reflect.DeepEqual(expected, result) {
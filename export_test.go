@@ -0,0 +1,30 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import "unsafe"
+
+// SetInitialDelay overrides the latency reported by the plugin.
+func SetInitialDelay(p *Plugin, delay int) {
+	*(*int32)(unsafe.Pointer(&p.p.initialDelay)) = int32(delay)
+}
+
+// RemoveProcessDouble makes the plugin float-only.
+func RemoveProcessDouble(p *Plugin) {
+	p.p.processDouble = nil
+	*(*int32)(unsafe.Pointer(&p.p.flags)) &^= int32(PluginDoubleProcessing)
+}
+
+// PoolPlugins returns the number of plugins registered in the pool.
+func PoolPlugins(p *Pool) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.processing)
+}
+
+// HostBufferSize returns the buffer size reported to the processor plugin
+// by host.
+func HostBufferSize(p *Processor) int {
+	return int(lookupCallback(int(p.plugin.p.resvd1))(HostGetBufferSize, 0, 0, nil, 0))
+}
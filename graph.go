@@ -0,0 +1,504 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"pipelined.dev/pipe"
+	"pipelined.dev/pipe/mutable"
+	"pipelined.dev/signal"
+)
+
+type (
+	// Graph is a network of plugins that is processed as a single pipe
+	// processor. Nodes are connected with audio connections between
+	// the channels and MIDI connections between the nodes. An output
+	// can be connected to multiple inputs and multiple outputs connected
+	// to the same input are summed. Graph compensates the latency of
+	// every path, so parallel branches stay aligned.
+	Graph struct {
+		input  *Node
+		output *Node
+		nodes  []*Node
+		audio  []*audioConnection
+		midi   []*midiConnection
+		// events are received by graph input.
+		events *EventScheduler
+
+		bufferSize int
+		sampleRate signal.Frequency
+		// order of nodes processing.
+		order    []*Node
+		position int64
+		// latency is the latency of the graph output.
+		latency int64
+		// ioChanged is set when any plugin signals HostIOChanged.
+		ioChanged int32
+	}
+
+	// Node is a vertex of the graph. Graph input and output are nodes
+	// without plugin.
+	Node struct {
+		graph  *Graph
+		plugin *Plugin
+		// inputs and outputs are the numbers of node channels.
+		inputs  int
+		outputs int
+		in, out DoubleBuffer
+		// events are delivered to the plugin.
+		events *EventScheduler
+		// sent holds events produced by plugin in the current block.
+		mu   sync.Mutex
+		sent []TimedEvent
+		// capture receives events produced by plugin.
+		capture *MIDICapture
+		// delay is the latency of the node input and arrival is the
+		// latency of the node output.
+		delay   int
+		arrival int
+	}
+
+	audioConnection struct {
+		from   *Node
+		output int
+		to     *Node
+		input  int
+		delay  delayLine
+	}
+
+	midiConnection struct {
+		from  *Node
+		to    *Node
+		delay int
+	}
+)
+
+// ErrGraphCycle is returned when connection creates a cycle in the graph.
+var ErrGraphCycle = errors.New("connection creates a cycle")
+
+// NewGraph returns a graph with provided number of output channels. The
+// number of input channels is defined by the line.
+func NewGraph(outputs int) *Graph {
+	g := Graph{events: NewEventScheduler(0)}
+	g.input = &Node{graph: &g}
+	g.output = &Node{graph: &g, inputs: outputs}
+	return &g
+}
+
+// Input returns the node that provides the line signal and receives
+// events sent to the graph.
+func (g *Graph) Input() *Node {
+	return g.input
+}
+
+// Output returns the node that provides the graph output signal.
+func (g *Graph) Output() *Node {
+	return g.output
+}
+
+// Add creates a plugin node. Graph overrides GetBufferSize and
+// GetSampleRate callbacks. ProcessEvents and IOChanged callbacks are
+// wrapped to route and capture plugin events and to track the plugin
+// latency. CanDo callback reports start and stop process support.
+func (g *Graph) Add(v *VST, h Host) *Node {
+	n := &Node{graph: g, events: NewEventScheduler(0)}
+	h.GetBufferSize = func() int {
+		return g.bufferSize
+	}
+	h.GetSampleRate = func() signal.Frequency {
+		return g.sampleRate
+	}
+	canDo := supportCanDo(h.CanDo, HostCanStartStopProcess)
+	h.CanDo = func(s HostCanDoString) CanDoResponse {
+		return n.capture.canDo(canDo)(s)
+	}
+	ioChanged := h.IOChanged
+	h.IOChanged = func() bool {
+		atomic.StoreInt32(&g.ioChanged, 1)
+		if ioChanged != nil {
+			return ioChanged()
+		}
+		return true
+	}
+	processEvents := h.ProcessEvents
+	h.ProcessEvents = func(events *EventsPtr) {
+		n.receive(events)
+		if n.capture != nil {
+			n.capture.capture(events)
+		}
+		if processEvents != nil {
+			processEvents(events)
+		}
+	}
+	n.plugin = v.Plugin(h.Callback())
+	n.inputs, n.outputs = n.plugin.NumInputs(), n.plugin.NumOutputs()
+	g.nodes = append(g.nodes, n)
+	return n
+}
+
+// Plugin returns the plugin of the node. It's nil for graph input and
+// output.
+func (n *Node) Plugin() *Plugin {
+	return n.plugin
+}
+
+// SetCapture attaches capture that receives events sent by the node
+// plugin. Graph updates the capture position before every block, so events
+// are positioned in the line frames. Host reports that it can receive
+// events if capture is set. Capture must be set before the graph is
+// allocated.
+func (n *Node) SetCapture(c *MIDICapture) {
+	n.capture = c
+}
+
+// Connect connects the output channel of one node to the input channel of
+// another node. Input channels of the graph input are validated when the
+// graph is allocated.
+func (g *Graph) Connect(from *Node, output int, to *Node, input int) error {
+	if err := g.validate(from, to); err != nil {
+		return err
+	}
+	if from != g.input && (output < 0 || output >= from.outputs) {
+		return fmt.Errorf("output %d is out of range [0, %d)", output, from.outputs)
+	}
+	if input < 0 || input >= to.inputs {
+		return fmt.Errorf("input %d is out of range [0, %d)", input, to.inputs)
+	}
+	g.audio = append(g.audio, &audioConnection{
+		from:   from,
+		output: output,
+		to:     to,
+		input:  input,
+	})
+	return nil
+}
+
+// ConnectMIDI routes events produced by one node into another node. Events
+// sent to the graph are produced by the graph input.
+func (g *Graph) ConnectMIDI(from, to *Node) error {
+	if err := g.validate(from, to); err != nil {
+		return err
+	}
+	if to == g.output {
+		return errors.New("graph output doesn't receive events")
+	}
+	g.midi = append(g.midi, &midiConnection{from: from, to: to})
+	return nil
+}
+
+// validate checks that connection between the nodes is allowed.
+func (g *Graph) validate(from, to *Node) error {
+	if from.graph != g || to.graph != g {
+		return errors.New("node belongs to another graph")
+	}
+	if from == g.output {
+		return errors.New("graph output can't be connected to nodes")
+	}
+	if to == g.input {
+		return errors.New("nodes can't be connected to graph input")
+	}
+	if from == to || g.reachable(to, from) {
+		return ErrGraphCycle
+	}
+	return nil
+}
+
+// reachable returns true if there is a path between nodes.
+func (g *Graph) reachable(from, to *Node) bool {
+	visited := map[*Node]bool{}
+	stack := []*Node{from}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == to {
+			return true
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+		for _, c := range g.audio {
+			if c.from == n {
+				stack = append(stack, c.to)
+			}
+		}
+		for _, c := range g.midi {
+			if c.from == n {
+				stack = append(stack, c.to)
+			}
+		}
+	}
+	return false
+}
+
+// SendEvents queues events that are received by the graph input. Events
+// are addressed by the absolute sample position in the processed line and
+// delayed by the latency of the path to every node. It's safe to call this
+// method while the line is running.
+func (g *Graph) SendEvents(events ...TimedEvent) {
+	g.events.Schedule(events...)
+}
+
+// Latency returns the latency of the graph output in frames. It's known
+// after the line is started.
+func (g *Graph) Latency() int {
+	return int(atomic.LoadInt64(&g.latency))
+}
+
+// Close closes all plugins of the graph.
+func (g *Graph) Close() {
+	for _, n := range g.nodes {
+		n.plugin.Close()
+	}
+}
+
+// Allocator returns pipe processor allocator that can be plugged into line.
+// Init function is applied to every plugin of the graph.
+func (g *Graph) Allocator(init ProcessorInitFunc) pipe.ProcessorAllocatorFunc {
+	return func(mctx mutable.Context, bufferSize int, props pipe.SignalProperties) (pipe.Processor, error) {
+		for _, c := range g.audio {
+			if c.from == g.input && c.output >= props.Channels {
+				return pipe.Processor{}, fmt.Errorf("graph input %d is out of range [0, %d)", c.output, props.Channels)
+			}
+		}
+		g.bufferSize = bufferSize
+		g.sampleRate = props.SampleRate
+		g.input.outputs = props.Channels
+		g.order = g.sort()
+		for _, n := range g.nodes {
+			n.plugin.Start()
+			n.plugin.SetSampleRate(props.SampleRate)
+			n.plugin.SetBufferSize(bufferSize)
+			if init != nil {
+				init(n.plugin)
+			}
+			n.plugin.SetPrecision(PreferDouble)
+		}
+		for _, n := range append([]*Node{g.input, g.output}, g.nodes...) {
+			n.in = NewDoubleBuffer(n.inputs, bufferSize)
+			n.out = NewDoubleBuffer(n.outputs, bufferSize)
+		}
+		for _, c := range g.audio {
+			c.delay = delayLine{scratch: make([]float64, bufferSize)}
+		}
+		g.position = 0
+		atomic.StoreInt32(&g.ioChanged, 0)
+		return pipe.Processor{
+			SignalProperties: pipe.SignalProperties{
+				Channels:   g.output.inputs,
+				SampleRate: props.SampleRate,
+			},
+			StartFunc: func(context.Context) error {
+				for _, n := range g.nodes {
+					n.plugin.Resume()
+					n.plugin.StartProcess()
+				}
+				// plugins initialize the delay on resume.
+				g.compensate()
+				return nil
+			},
+			ProcessFunc: g.process,
+			FlushFunc:   g.flush,
+		}, nil
+	}
+}
+
+// sort returns nodes in topological order. Connect doesn't allow cycles,
+// so all nodes are ordered.
+func (g *Graph) sort() []*Node {
+	nodes := append([]*Node{g.input}, g.nodes...)
+	nodes = append(nodes, g.output)
+	degree := make(map[*Node]int, len(nodes))
+	for _, c := range g.audio {
+		degree[c.to]++
+	}
+	for _, c := range g.midi {
+		degree[c.to]++
+	}
+	order := make([]*Node, 0, len(nodes))
+	for _, n := range nodes {
+		if degree[n] == 0 {
+			order = append(order, n)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		n := order[i]
+		release := func(to *Node) {
+			if degree[to]--; degree[to] == 0 {
+				order = append(order, to)
+			}
+		}
+		for _, c := range g.audio {
+			if c.from == n {
+				release(c.to)
+			}
+		}
+		for _, c := range g.midi {
+			if c.from == n {
+				release(c.to)
+			}
+		}
+	}
+	return order
+}
+
+// compensate computes the latency of every node and sets the delays of
+// connections, so all inputs of the node are aligned.
+func (g *Graph) compensate() {
+	for _, n := range g.order {
+		n.delay = 0
+		for _, c := range g.audio {
+			if c.to == n && c.from.arrival > n.delay {
+				n.delay = c.from.arrival
+			}
+		}
+		for _, c := range g.midi {
+			if c.to == n && c.from.arrival > n.delay {
+				n.delay = c.from.arrival
+			}
+		}
+		n.arrival = n.delay
+		if n.plugin != nil {
+			n.arrival += n.plugin.InitialDelay()
+		}
+	}
+	for _, c := range g.audio {
+		c.delay.setDelay(1, c.to.delay-c.from.arrival)
+	}
+	for _, c := range g.midi {
+		c.delay = c.to.delay - c.from.arrival
+	}
+	atomic.StoreInt64(&g.latency, int64(g.output.arrival))
+}
+
+// process runs all nodes in topological order.
+func (g *Graph) process(in, out signal.Floating) (int, error) {
+	if atomic.CompareAndSwapInt32(&g.ioChanged, 1, 0) {
+		g.compensate()
+	}
+	frames := in.Length()
+	for c := 0; c < g.input.outputs; c++ {
+		readChannel(in, c, 0, g.input.out.Channel(c)[:frames])
+	}
+	g.route(g.input, g.events.Next(g.position, frames))
+	for _, n := range g.order {
+		if n == g.input {
+			continue
+		}
+		g.mix(n, frames)
+		if n.plugin == nil {
+			continue
+		}
+		if n.capture != nil {
+			n.capture.setBlock(g.position, 1)
+		}
+		if events := n.events.Next(g.position, frames); events != nil {
+			n.plugin.SendEvents(events)
+		}
+		input, output := n.in, n.out
+		input.Frames, output.Frames = frames, frames
+		n.plugin.processZeroed(input, output)
+		n.mu.Lock()
+		sent := n.sent
+		n.sent = nil
+		n.mu.Unlock()
+		for i := range sent {
+			sent[i].Position += g.position
+		}
+		g.routeTimed(n, sent)
+	}
+	for c := 0; c < g.output.inputs; c++ {
+		writeChannel(out, c, 0, g.output.in.Channel(c)[:frames])
+	}
+	g.position += int64(frames)
+	return frames, nil
+}
+
+// mix sums delayed outputs connected to the node inputs.
+func (g *Graph) mix(n *Node, frames int) {
+	for c := range n.in.data {
+		zero(n.in.Channel(c)[:frames])
+	}
+	for _, c := range g.audio {
+		if c.to != n {
+			continue
+		}
+		delayed := c.delay.process(0, c.from.out.Channel(c.output)[:frames], frames)
+		c.delay.advance(frames)
+		row := n.in.Channel(c.input)[:frames]
+		for i := range row {
+			row[i] += delayed[i]
+		}
+	}
+}
+
+// route passes events with block-relative positions to connected nodes,
+// delayed by the path compensation.
+func (g *Graph) route(from *Node, events *EventsPtr) {
+	if events == nil {
+		return
+	}
+	for _, c := range g.midi {
+		if c.from != from {
+			continue
+		}
+		for i := 0; i < events.NumEvents(); i++ {
+			e := events.Event(i)
+			c.to.events.Schedule(TimedEvent{
+				Position: g.position + int64(deltaFrames(e)+int32(c.delay)),
+				Event:    e,
+			})
+		}
+	}
+}
+
+// routeTimed passes events to connected nodes, delayed by the path
+// compensation.
+func (g *Graph) routeTimed(from *Node, events []TimedEvent) {
+	if len(events) == 0 {
+		return
+	}
+	for _, c := range g.midi {
+		if c.from != from {
+			continue
+		}
+		for _, e := range events {
+			e.Position += int64(c.delay)
+			c.to.events.Schedule(e)
+		}
+	}
+}
+
+// receive keeps events produced by plugin during the process call.
+func (n *Node) receive(events *EventsPtr) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for i := 0; i < events.NumEvents(); i++ {
+		e := copyEvent(events.Event(i))
+		if e == nil {
+			continue
+		}
+		n.sent = append(n.sent, TimedEvent{Position: int64(deltaFrames(e)), Event: e})
+	}
+}
+
+func (g *Graph) flush(context.Context) error {
+	for _, n := range append([]*Node{g.input, g.output}, g.nodes...) {
+		n.in.Free()
+		n.out.Free()
+		n.in, n.out = DoubleBuffer{}, DoubleBuffer{}
+	}
+	g.events.Free()
+	for _, n := range g.nodes {
+		n.events.Free()
+		n.plugin.StopProcess()
+		n.plugin.Suspend()
+	}
+	return nil
+}
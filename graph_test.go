@@ -0,0 +1,108 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+func TestGraph(t *testing.T) {
+	path := skipIfNoPlugin(t)
+	v, err := vst2.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	const (
+		channels   = 2
+		bufferSize = 64
+		sampleRate = 44100
+	)
+
+	t.Run("delay compensation", func(t *testing.T) {
+		t.Parallel()
+		const (
+			length  = 150
+			latency = 10
+		)
+		g := vst2.NewGraph(3)
+		defer g.Close()
+		a, b := g.Add(v, vst2.Host{}), g.Add(v, vst2.Host{})
+		connect := func(from *vst2.Node, output int, to *vst2.Node, input int) {
+			if err := g.Connect(from, output, to, input); err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+		}
+		for c := 0; c < channels; c++ {
+			// fan-out of graph input.
+			connect(g.Input(), c, a, c)
+			connect(g.Input(), c, b, c)
+		}
+		connect(a, 0, g.Output(), 0)
+		connect(b, 0, g.Output(), 1)
+		// summing of both branches.
+		connect(a, 1, g.Output(), 2)
+		connect(b, 1, g.Output(), 2)
+
+		result := runLine(t, bufferSize,
+			rampSource(channels, sampleRate, length),
+			g.Allocator(func(p *vst2.Plugin) {
+				if p == a.Plugin() {
+					vst2.SetInitialDelay(p, latency)
+				}
+			}),
+		)
+		assertEqual(t, "latency", g.Latency(), latency)
+		assertEqual(t, "channels", len(result), 3)
+		for i := 0; i < length; i++ {
+			// demo plugin doesn't delay the signal.
+			assertEqual(t, "delayed node", result[0][i], float64(i))
+			delayed := 0.0
+			if i >= latency {
+				delayed = float64(i - latency)
+			}
+			assertEqual(t, "compensated node", result[1][i], delayed)
+			assertEqual(t, "summed", result[2][i], float64(i)+delayed)
+		}
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		t.Parallel()
+		g := vst2.NewGraph(channels)
+		defer g.Close()
+		a, b := g.Add(v, vst2.Host{}), g.Add(v, vst2.Host{})
+		if err := g.Connect(a, 0, b, 0); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		if err := g.Connect(b, 0, a, 1); !errors.Is(err, vst2.ErrGraphCycle) {
+			t.Fatalf("expected cycle error, got: %v", err)
+		}
+		if err := g.ConnectMIDI(b, a); !errors.Is(err, vst2.ErrGraphCycle) {
+			t.Fatalf("expected cycle error, got: %v", err)
+		}
+		if err := g.Connect(a, channels, b, 0); err == nil {
+			t.Fatal("expected error for output out of range")
+		}
+		if err := g.Connect(a, 0, g.Output(), channels); err == nil {
+			t.Fatal("expected error for input out of range")
+		}
+		if err := g.Connect(a, 0, g.Input(), 0); err == nil {
+			t.Fatal("expected error for connection to graph input")
+		}
+		if err := g.ConnectMIDI(g.Input(), g.Output()); err == nil {
+			t.Fatal("expected error for events to graph output")
+		}
+		if err := g.ConnectMIDI(g.Input(), a); err != nil {
+			t.Fatalf("failed to connect events: %v", err)
+		}
+		other := vst2.NewGraph(channels)
+		if err := g.Connect(other.Input(), 0, a, 0); err == nil {
+			t.Fatal("expected error for node of another graph")
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package vst2
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// handleTable keeps values that C structures refer to by handles. Handle
+// is the index in the table, offset by one, so zero is never valid. Table
+// is copied on write, so values are looked up without lock. Indices of
+// removed values are reused.
+type handleTable struct {
+	sync.Mutex
+	table atomic.Value // []interface{}
+	free  []int
+}
+
+// register adds value to the table and returns its handle.
+func (t *handleTable) register(v interface{}) int {
+	t.Lock()
+	defer t.Unlock()
+	table, _ := t.table.Load().([]interface{})
+	index := len(table)
+	if n := len(t.free); n > 0 {
+		index = t.free[n-1]
+		t.free = t.free[:n-1]
+	}
+	updated := make([]interface{}, len(table), len(table)+1)
+	copy(updated, table)
+	if index == len(updated) {
+		updated = append(updated, nil)
+	}
+	updated[index] = v
+	t.table.Store(updated)
+	return index + 1
+}
+
+// unregister removes value from the table.
+func (t *handleTable) unregister(handle int) {
+	t.Lock()
+	defer t.Unlock()
+	table, _ := t.table.Load().([]interface{})
+	index := handle - 1
+	if index < 0 || index >= len(table) || table[index] == nil {
+		return
+	}
+	updated := make([]interface{}, len(table))
+	copy(updated, table)
+	updated[index] = nil
+	t.free = append(t.free, index)
+	t.table.Store(updated)
+}
+
+// lookup returns the value by its handle. Nil is returned for invalid
+// handles.
+func (t *handleTable) lookup(handle int) interface{} {
+	table, _ := t.table.Load().([]interface{})
+	if index := handle - 1; index >= 0 && index < len(table) {
+		return table[index]
+	}
+	return nil
+}
@@ -26,6 +26,12 @@ type (
 		GetDirectory       HostGetDirectoryFunc
 		BeginEdit          HostBeginEditFunc
 		EndEdit            HostEndEditFunc
+		// Offline callbacks are used by offline plugins.
+		OfflineStart              HostOfflineStartFunc
+		OfflineRead               HostOfflineReadFunc
+		OfflineWrite              HostOfflineWriteFunc
+		OfflineGetCurrentPass     HostOfflineGetCurrentPassFunc
+		OfflineGetCurrentMetaPass HostOfflineGetCurrentPassFunc
 	}
 
 	// HostGetSampleRateFunc returns host sample rate.
@@ -70,4 +76,12 @@ type (
 	HostBeginEditFunc func(index int32) bool
 	// HostEndEditFunc is called when a parameter edit has ended. Returns true on success.
 	HostEndEditFunc func(index int32) bool
+	// HostOfflineStartFunc is called when offline plugin is ready to process the files. New files are at the end of the slice. Returns true on success.
+	HostOfflineStartFunc func(files []AudioFile, numNewFiles int) bool
+	// HostOfflineReadFunc is called when offline plugin reads data. Source is true if original file must be read. Returns true on success.
+	HostOfflineReadFunc func(task *OfflineTask, option OfflineOption, source bool) bool
+	// HostOfflineWriteFunc is called when offline plugin writes data. Returns true on success.
+	HostOfflineWriteFunc func(task *OfflineTask, option OfflineOption) bool
+	// HostOfflineGetCurrentPassFunc returns the current offline pass.
+	HostOfflineGetCurrentPassFunc func() int32
 )
@@ -11,19 +11,14 @@ import "C"
 
 import (
 	"fmt"
-	"sync"
 	"unsafe"
 
 	"pipelined.dev/signal"
 )
 
-// global state for callbacks.
-var callbacks = struct {
-	sync.RWMutex
-	mapping map[unsafe.Pointer]HostCallbackFunc
-}{
-	mapping: map[unsafe.Pointer]HostCallbackFunc{},
-}
+// callbacks of plugins. Plugin keeps the handle of its callback in resvd1
+// field, zero means no callback.
+var callbacks handleTable
 
 const (
 	// VST main function name.
@@ -44,6 +39,25 @@ type (
 	// Plugin is an instance of loaded VST plugin.
 	Plugin struct {
 		p *C.CPlugin
+		// precision is set when it's negotiated with SetPrecision.
+		precision  ProcessPrecision
+		negotiated bool
+		// buffers to convert signal when plugin processes other
+		// precision.
+		doubleIn, doubleOut DoubleBuffer
+		floatIn, floatOut   FloatBuffer
+		// varIO is allocated with first ProcessVarIO call.
+		varIO *variableIO
+		// sanitizer checks the output if set.
+		sanitizer *Sanitizer
+		// uniqueID and name are reported with sanitizer incidents.
+		uniqueID int32
+		name     string
+		// processed is the number of frames processed since the
+		// sanitizer was set.
+		processed int64
+		// onClose is called when plugin is closed.
+		onClose func()
 	}
 
 	// pluginMain is a reference to VST main function.
@@ -132,8 +146,8 @@ func (h Host) Callback() HostCallbackFunc {
 				return int64(h.GetVendorVersion())
 			}
 		case HostCanDo:
+			s := HostCanDoString(C.GoString((*C.char)(ptr)))
 			if h.CanDo != nil {
-				s := HostCanDoString(C.GoString((*C.char)(ptr)))
 				return int64(h.CanDo(s))
 			}
 		case HostGetLanguage:
@@ -163,11 +177,54 @@ func (h Host) Callback() HostCallbackFunc {
 					return 1
 				}
 			}
+		case HostOfflineStart:
+			if h.OfflineStart != nil && ptr != nil {
+				files := (*[1 << 16]AudioFile)(ptr)[:value:value]
+				if h.OfflineStart(files, int(index)) {
+					return 1
+				}
+			}
+		case HostOfflineRead:
+			if h.OfflineRead != nil {
+				if h.OfflineRead((*OfflineTask)(ptr), OfflineOption(value), index != 0) {
+					return 1
+				}
+			}
+		case HostOfflineWrite:
+			if h.OfflineWrite != nil {
+				if h.OfflineWrite((*OfflineTask)(ptr), OfflineOption(value)) {
+					return 1
+				}
+			}
+		case HostOfflineGetCurrentPass:
+			if h.OfflineGetCurrentPass != nil {
+				return int64(h.OfflineGetCurrentPass())
+			}
+		case HostOfflineGetCurrentMetaPass:
+			if h.OfflineGetCurrentMetaPass != nil {
+				return int64(h.OfflineGetCurrentMetaPass())
+			}
 		}
 		return 0
 	}
 }
 
+// supportCanDo wraps CanDo callback to report provided capabilities. Other
+// queries are passed to the wrapped callback.
+func supportCanDo(fn HostCanDoFunc, supported ...HostCanDoString) HostCanDoFunc {
+	return func(s HostCanDoString) CanDoResponse {
+		for _, c := range supported {
+			if s == c {
+				return YesCanDo
+			}
+		}
+		if fn != nil {
+			return fn(s)
+		}
+		return MaybeCanDo
+	}
+}
+
 // NoopHostCallback returns dummy host callback that just prints received
 // opcodes.
 func NoopHostCallback() HostCallbackFunc {
@@ -184,13 +241,26 @@ func (v *VST) Plugin(c HostCallbackFunc) *Plugin {
 		return nil
 	}
 	p := C.loadPluginHostBridge(v.main)
-	callbacks.Lock()
-	callbacks.mapping[unsafe.Pointer(p)] = c
-	callbacks.Unlock()
-
+	p.resvd1 = C.int64_t(registerCallback(c))
 	return &Plugin{p: p}
 }
 
+// registerCallback adds callback to the table and returns its handle.
+func registerCallback(c HostCallbackFunc) int {
+	return callbacks.register(c)
+}
+
+// unregisterCallback removes callback from the table.
+func unregisterCallback(handle int) {
+	callbacks.unregister(handle)
+}
+
+// lookupCallback returns the callback by its handle.
+func lookupCallback(handle int) HostCallbackFunc {
+	c, _ := callbacks.lookup(handle).(HostCallbackFunc)
+	return c
+}
+
 // Dispatch wraps-up C method to dispatch calls to plugin
 func (p *Plugin) Dispatch(opcode PluginOpcode, index int32, value int64, ptr unsafe.Pointer, opt float32) uintptr {
 	return uintptr(C.dispatchHostBridge(p.p, C.int32_t(opcode), C.int32_t(index), C.int64_t(value), ptr, C.float(opt)))
@@ -219,8 +289,59 @@ func (p *Plugin) Flags() PluginFlag {
 	return PluginFlag(p.p.flags)
 }
 
-// ProcessDouble audio with VST plugin.
+// ProcessDouble audio with VST plugin. If plugin processes float32, the
+// signal is converted.
 func (p *Plugin) ProcessDouble(in, out DoubleBuffer) {
+	if p.processPrecision(ProcessDouble) == ProcessFloat {
+		out.Frames = in.Frames
+		p.floatIn = growFloatBuffer(p.floatIn, len(in.data), in.Frames)
+		p.floatOut = growFloatBuffer(p.floatOut, len(out.data), in.Frames)
+		floatIn, floatOut := p.floatIn, p.floatOut
+		floatIn.Frames, floatOut.Frames = in.Frames, in.Frames
+		convertToFloat(in, floatIn)
+		p.processFloat(floatIn, floatOut)
+		// float output is checked before conversion to detect float
+		// denormals.
+		p.sanitizeFloat(floatOut)
+		convertToDouble(floatOut, out)
+		return
+	}
+	p.processDouble(in, out)
+	out.Frames = in.Frames
+	p.sanitizeDouble(out)
+}
+
+// processZeroed clears the output and processes audio with double
+// precision.
+func (p *Plugin) processZeroed(in, out DoubleBuffer) {
+	// plugins are not required to write every output.
+	for c := range out.data {
+		zero(out.Channel(c))
+	}
+	p.ProcessDouble(in, out)
+}
+
+// ProcessFloat audio with VST plugin. If plugin processes float64, the
+// signal is converted.
+func (p *Plugin) ProcessFloat(in, out FloatBuffer) {
+	if p.processPrecision(ProcessFloat) == ProcessDouble {
+		out.Frames = in.Frames
+		p.doubleIn = growDoubleBuffer(p.doubleIn, len(in.data), in.Frames)
+		p.doubleOut = growDoubleBuffer(p.doubleOut, len(out.data), in.Frames)
+		doubleIn, doubleOut := p.doubleIn, p.doubleOut
+		doubleIn.Frames, doubleOut.Frames = in.Frames, in.Frames
+		convertToDouble(in, doubleIn)
+		p.processDouble(doubleIn, doubleOut)
+		convertToFloat(doubleOut, out)
+		p.sanitizeFloat(out)
+		return
+	}
+	p.processFloat(in, out)
+	out.Frames = in.Frames
+	p.sanitizeFloat(out)
+}
+
+func (p *Plugin) processDouble(in, out DoubleBuffer) {
 	C.processDoubleHostBridge(
 		p.p,
 		in.cArray(),
@@ -229,8 +350,7 @@ func (p *Plugin) ProcessDouble(in, out DoubleBuffer) {
 	)
 }
 
-// ProcessFloat audio with VST plugin.
-func (p *Plugin) ProcessFloat(in, out FloatBuffer) {
+func (p *Plugin) processFloat(in, out FloatBuffer) {
 	C.processFloatHostBridge(
 		p.p,
 		in.cArray(),
@@ -239,6 +359,66 @@ func (p *Plugin) ProcessFloat(in, out FloatBuffer) {
 	)
 }
 
+// SetPrecision negotiates the processing precision with plugin and returns
+// the result. It must be called before plugin is resumed. ProcessDouble
+// and ProcessFloat convert the signal if it doesn't match the negotiated
+// precision. Forced precision falls back to the other one if plugin
+// doesn't implement its process function.
+func (p *Plugin) SetPrecision(policy PrecisionPolicy) ProcessPrecision {
+	switch policy {
+	case PreferFloat:
+		p.precision = p.supportedPrecision(ProcessFloat)
+	case ForceDouble:
+		p.precision = p.implementedPrecision(ProcessDouble)
+	case ForceFloat:
+		p.precision = p.implementedPrecision(ProcessFloat)
+	default:
+		p.precision = p.supportedPrecision(ProcessDouble)
+	}
+	p.negotiated = true
+	p.Dispatch(PlugSetProcessPrecision, 0, int64(p.precision), nil, 0)
+	return p.precision
+}
+
+// Precision returns the processing precision of plugin. If it wasn't
+// negotiated, the precision supported by plugin is returned.
+func (p *Plugin) Precision() ProcessPrecision {
+	return p.processPrecision(ProcessDouble)
+}
+
+// processPrecision returns the precision used to process the requested
+// one.
+func (p *Plugin) processPrecision(requested ProcessPrecision) ProcessPrecision {
+	if p.negotiated {
+		return p.precision
+	}
+	return p.supportedPrecision(requested)
+}
+
+// supportedPrecision returns the requested precision if plugin supports
+// it or if plugin doesn't support the other one.
+func (p *Plugin) supportedPrecision(requested ProcessPrecision) ProcessPrecision {
+	switch {
+	case requested == ProcessDouble && !p.CanProcessFloat64() && p.CanProcessFloat32():
+		return ProcessFloat
+	case requested == ProcessFloat && !p.CanProcessFloat32() && p.CanProcessFloat64():
+		return ProcessDouble
+	}
+	return requested
+}
+
+// implementedPrecision returns the requested precision if plugin
+// implements its process function regardless of plugin flags.
+func (p *Plugin) implementedPrecision(requested ProcessPrecision) ProcessPrecision {
+	switch {
+	case requested == ProcessDouble && p.p.processDouble == nil && p.p.processFloat != nil:
+		return ProcessFloat
+	case requested == ProcessFloat && p.p.processFloat == nil && p.p.processDouble != nil:
+		return ProcessDouble
+	}
+	return requested
+}
+
 // ParamValue returns the value of parameter.
 func (p *Plugin) ParamValue(index int) float32 {
 	return float32(C.getParameterHostBridge(p.p, C.int32_t(index)))
@@ -266,10 +446,18 @@ func (p *Plugin) Start() {
 
 // Close stops the plugin and cleans up C refs for plugin.
 func (p *Plugin) Close() {
+	// plugin is freed on close.
+	handle := int(p.p.resvd1)
 	p.Dispatch(plugClose, 0, 0, nil, 0.0)
-	callbacks.Lock()
-	delete(callbacks.mapping, unsafe.Pointer(p))
-	callbacks.Unlock()
+	p.doubleIn.Free()
+	p.doubleOut.Free()
+	p.floatIn.Free()
+	p.floatOut.Free()
+	p.freeVarIO()
+	unregisterCallback(handle)
+	if p.onClose != nil {
+		p.onClose()
+	}
 }
 
 // Resume the plugin processing. It must be called before processing is
@@ -284,6 +472,18 @@ func (p *Plugin) Suspend() {
 	p.Dispatch(plugStateChanged, 0, 0, nil, 0)
 }
 
+// StartProcess notifies the plugin that process calls are about to start.
+// It must be called after Resume.
+func (p *Plugin) StartProcess() {
+	p.Dispatch(PlugStartProcess, 0, 0, nil, 0)
+}
+
+// StopProcess notifies the plugin that process calls are stopped. It must
+// be called before Suspend.
+func (p *Plugin) StopProcess() {
+	p.Dispatch(PlugStopProcess, 0, 0, nil, 0)
+}
+
 // SetBufferSize sets a buffer size per channel.
 func (p *Plugin) SetBufferSize(bufferSize int) {
 	p.Dispatch(plugSetBufferSize, 0, int64(bufferSize), nil, 0)
@@ -403,7 +603,7 @@ func stringToCString(s string) *C.char {
 
 // SendEvents sends MIDI events to the hosted plugin. The caller creates
 // events via the Events() constructor and is responsible for calling
-// Free() afterward.
+// Free() afterward, or reuses EventsBuffer to avoid allocations.
 func (p *Plugin) SendEvents(events *EventsPtr) {
 	p.Dispatch(PlugProcessEvents, 0, 0, unsafe.Pointer(events), 0)
 }
@@ -435,6 +635,64 @@ func (p *Plugin) EditorIdle() {
 	p.Dispatch(PlugEditIdle, 0, 0, nil, 0)
 }
 
+// OfflineNotify notifies plugin about audio files opened by host. Start is
+// true when plugin can start offline processing. Files must stay valid
+// while plugin uses them. Returns false if plugin doesn't support offline
+// processing.
+func (p *Plugin) OfflineNotify(files []AudioFile, start bool) bool {
+	var index int32
+	if start {
+		index = 1
+	}
+	return p.Dispatch(PlugOfflineNotify, index, int64(len(files)), audioFilesPtr(files), 0) > 0
+}
+
+// OfflinePrepare asks plugin to prepare offline tasks. Plugin sets the
+// buffer sizes and flags of tasks. Returns false if plugin can't process
+// tasks.
+func (p *Plugin) OfflinePrepare(tasks []OfflineTask) bool {
+	return p.Dispatch(PlugOfflinePrepare, 0, int64(len(tasks)), offlineTasksPtr(tasks), 0) > 0
+}
+
+// OfflineRun asks plugin to process offline tasks. Plugin reads and writes
+// data with host offline callbacks. Returns false if plugin failed.
+func (p *Plugin) OfflineRun(tasks []OfflineTask) bool {
+	return p.Dispatch(PlugOfflineRun, 0, int64(len(tasks)), offlineTasksPtr(tasks), 0) > 0
+}
+
+func audioFilesPtr(files []AudioFile) unsafe.Pointer {
+	if len(files) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&files[0])
+}
+
+func offlineTasksPtr(tasks []OfflineTask) unsafe.Pointer {
+	if len(tasks) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&tasks[0])
+}
+
+// SetBypass switches the plugin bypass. Returns false if plugin doesn't
+// support bypass, in this case the request is not sent.
+func (p *Plugin) SetBypass(bypass bool) bool {
+	if p.CanDo(PluginCanBypass) != YesCanDo {
+		return false
+	}
+	p.setBypass(bypass)
+	return true
+}
+
+// setBypass sends the bypass state without querying plugin capabilities.
+func (p *Plugin) setBypass(bypass bool) {
+	var value int64
+	if bypass {
+		value = 1
+	}
+	p.Dispatch(PlugSetBypass, 0, value, nil, 0)
+}
+
 // CanDo queries the plugin about its capabilities. Returns YesCanDo,
 // NoCanDo, or MaybeCanDo.
 func (p *Plugin) CanDo(s PluginCanDoString) CanDoResponse {
@@ -12,19 +12,17 @@ import "unsafe"
 //export hostCallbackBridge
 func hostCallbackBridge(p *C.CPlugin, opcode int32, index int32, value int64, ptr unsafe.Pointer, opt float32) int64 {
 	// HostVersion is requested when plugin is created
-	// It's never in map
+	// It's never registered
 	if HostOpcode(opcode) == HostVersion {
 		return version
 	}
-	callbacks.RLock()
-	c, ok := callbacks.mapping[unsafe.Pointer(p)]
-	callbacks.RUnlock()
-	if !ok {
-		panic("plugin was closed")
+	if p == nil || p.resvd1 == 0 {
+		// plugin is not registered yet.
+		return 0
 	}
-
+	c := lookupCallback(int(p.resvd1))
 	if c == nil {
-		panic("host callback is undefined")
+		panic("plugin was closed")
 	}
 	return c(HostOpcode(opcode), index, value, ptr, opt)
 }
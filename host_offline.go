@@ -0,0 +1,475 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"pipelined.dev/signal"
+)
+
+// DefaultOfflineBufferSize is the size of offline task buffers in frames
+// if plugin doesn't set it.
+const DefaultOfflineBufferSize = 4096
+
+type (
+	// OfflineFile is an audio file processed by offline plugin.
+	OfflineFile struct {
+		Name string
+		// Source is the original audio, it's never modified. New files
+		// created by plugin have no source.
+		Source OfflineAudio
+		// Destination receives the audio written by plugin. If nil,
+		// MemoryAudio is created when plugin writes the first frames.
+		Destination OfflineAudio
+		Markers     []AudioFileMarker
+		// Cursor is the position of edit cursor in frames.
+		Cursor int
+		// SelectionStart and SelectionSize define the processed region.
+		// The whole file is processed if SelectionSize is zero.
+		SelectionStart int
+		SelectionSize  int
+		// Flags are capabilities of the file. Plugin requests are
+		// added on start.
+		Flags AudioFileFlag
+	}
+
+	// Offline processes audio files with offline plugin. Plugin reads and
+	// writes the files with host offline callbacks.
+	Offline struct {
+		Files []*OfflineFile
+		// BufferSize is the size of task buffers in frames if plugin
+		// doesn't set it. DefaultOfflineBufferSize is used if zero.
+		BufferSize int
+
+		plugin *Plugin
+		pass   int32
+		// files are passed to plugin in notifications.
+		files []AudioFile
+		// requested holds indices of files that plugin requested to
+		// process.
+		requested []int
+		// buffers holds task buffers per file index.
+		buffers map[int]offlineBuffers
+		// scratch is used to convert samples.
+		scratch [][]float64
+		// allocated C memory that is freed after run.
+		allocated []unsafe.Pointer
+	}
+
+	offlineBuffers struct {
+		in, out FloatBuffer
+	}
+)
+
+// Offline returns offline processing session for provided files. Offline
+// callbacks of provided host are replaced, host reports offline
+// capability and offline process level.
+func (v *VST) Offline(h Host, files ...*OfflineFile) *Offline {
+	o := &Offline{
+		Files:   files,
+		buffers: map[int]offlineBuffers{},
+	}
+	h.CanDo = supportCanDo(h.CanDo, HostCanOffline)
+	h.GetProcessLevel = func() ProcessLevel {
+		return ProcessLevelOffline
+	}
+	h.OfflineStart = o.start
+	h.OfflineRead = o.read
+	h.OfflineWrite = o.write
+	h.OfflineGetCurrentPass = func() int32 {
+		return o.pass
+	}
+	h.OfflineGetCurrentMetaPass = func() int32 {
+		return 0
+	}
+	o.plugin = v.Plugin(h.Callback())
+	o.plugin.Start()
+	if len(files) > 0 && files[0].Source != nil {
+		o.plugin.SetSampleRate(files[0].Source.SampleRate())
+	}
+	return o
+}
+
+// Plugin returns the plugin of offline session.
+func (o *Offline) Plugin() *Plugin {
+	return o.plugin
+}
+
+// Run notifies plugin about the files and processes them. Tasks are
+// created for the files that plugin requested with HostOfflineStart, or for
+// all files if plugin didn't request any.
+func (o *Offline) Run() error {
+	defer o.free()
+	o.files = o.audioFiles()
+	o.plugin.OfflineNotify(o.files, true)
+	defer o.plugin.OfflineNotify(o.files, false)
+
+	requested := o.requested
+	o.requested = nil
+	if len(requested) == 0 {
+		for i := range o.Files {
+			requested = append(requested, i)
+		}
+	}
+	tasks := o.tasks(requested)
+	if !o.plugin.OfflinePrepare(tasks) {
+		if err := taskError(tasks); err != nil {
+			return err
+		}
+		return errors.New("plugin doesn't support offline processing")
+	}
+	if err := taskError(tasks); err != nil {
+		return err
+	}
+	o.allocateBuffers(tasks)
+	ok := o.plugin.OfflineRun(tasks)
+	o.pass++
+	if err := taskError(tasks); err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("offline run failed")
+	}
+	return nil
+}
+
+// Close frees the session resources and closes the plugin.
+func (o *Offline) Close() {
+	o.free()
+	o.plugin.Close()
+}
+
+// audioFiles returns the description of files in C memory.
+func (o *Offline) audioFiles() []AudioFile {
+	files := (*[1 << 16]AudioFile)(o.allocate(len(o.Files), unsafe.Sizeof(AudioFile{})))[:len(o.Files):len(o.Files)]
+	for i, f := range o.Files {
+		af := &files[i]
+		af.hostOwned = uintptr(i + 1)
+		af.SetName(f.Name)
+		af.Flags = f.Flags
+		if audio := f.audio(); audio != nil {
+			af.SampleRate = float64(audio.SampleRate())
+			af.NumChannels = int32(audio.Channels())
+			af.NumFrames = float64(audio.Frames())
+		}
+		af.EditCursorPosition = float64(f.Cursor)
+		af.SelectionStart = float64(f.SelectionStart)
+		af.SelectionSize = float64(f.SelectionSize)
+		af.NumMarkers = int32(len(f.Markers))
+		af.SelectedChannelsMask = int32(1<<uint(af.NumChannels) - 1)
+	}
+	return files
+}
+
+// tasks returns tasks for files with provided indices in C memory.
+func (o *Offline) tasks(indices []int) []OfflineTask {
+	tasks := (*[1 << 16]OfflineTask)(o.allocate(len(indices), unsafe.Sizeof(OfflineTask{})))[:len(indices):len(indices)]
+	for i, index := range indices {
+		f, t := o.Files[index], &tasks[i]
+		t.hostOwned = uintptr(index + 1)
+		if f.Source == nil {
+			t.Flags |= OfflineNewFile
+		} else {
+			t.NumFramesInSourceFile = float64(f.Source.Frames())
+			t.SourceSampleRate = float64(f.Source.SampleRate())
+			t.NumSourceChannels = int32(f.Source.Channels())
+			t.NumFramesToProcess = t.NumFramesInSourceFile
+		}
+		if f.SelectionSize > 0 {
+			t.PositionToProcessFrom = float64(f.SelectionStart)
+			t.NumFramesToProcess = float64(f.SelectionSize)
+		}
+		if audio := f.audio(); audio != nil {
+			t.DestinationSampleRate = float64(audio.SampleRate())
+			t.NumDestinationChannels = int32(audio.Channels())
+		}
+		if f.Destination != nil {
+			t.DestinationSampleRate = float64(f.Destination.SampleRate())
+			t.NumDestinationChannels = int32(f.Destination.Channels())
+		}
+	}
+	return tasks
+}
+
+// bufferCapacity returns the number of frames of provided channels that
+// fit into the task buffer.
+func bufferCapacity(b FloatBuffer, channels int, interleaved bool) int {
+	if channels <= 0 {
+		return 0
+	}
+	if interleaved {
+		if len(b.data) != 1 {
+			return 0
+		}
+		return b.Frames / channels
+	}
+	if channels > len(b.data) {
+		return 0
+	}
+	return b.Frames
+}
+
+// allocateBuffers allocates input and output buffers of prepared tasks.
+func (o *Offline) allocateBuffers(tasks []OfflineTask) {
+	for i := range tasks {
+		t := &tasks[i]
+		if t.SizeInputBuffer <= 0 {
+			t.SizeInputBuffer = int32(o.bufferSize())
+		}
+		if t.SizeOutputBuffer <= 0 {
+			t.SizeOutputBuffer = int32(o.bufferSize())
+		}
+		var b offlineBuffers
+		if t.Flags&OfflineInterleavedAudio != 0 {
+			b.in = NewFloatBuffer(1, int(t.NumSourceChannels*t.SizeInputBuffer))
+			b.out = NewFloatBuffer(1, int(t.NumDestinationChannels*t.SizeOutputBuffer))
+			t.inputBuffer = unsafe.Pointer(b.in.data[0])
+			t.outputBuffer = unsafe.Pointer(b.out.data[0])
+		} else {
+			b.in = NewFloatBuffer(int(t.NumSourceChannels), int(t.SizeInputBuffer))
+			b.out = NewFloatBuffer(int(t.NumDestinationChannels), int(t.SizeOutputBuffer))
+			t.inputBuffer = unsafe.Pointer(b.in.cArray())
+			t.outputBuffer = unsafe.Pointer(b.out.cArray())
+		}
+		o.buffers[int(t.hostOwned)-1] = b
+	}
+}
+
+// start handles HostOfflineStart. Plugin requests the files to process and
+// creates new files.
+func (o *Offline) start(files []AudioFile, numNewFiles int) bool {
+	for i := range files {
+		af := &files[i]
+		index := int(af.hostOwned) - 1
+		if index < 0 || index >= len(o.Files) || i >= len(files)-numNewFiles {
+			o.Files = append(o.Files, &OfflineFile{
+				Name: af.Name.String(),
+				Destination: &MemoryAudio{
+					Rate: signal.Frequency(af.SampleRate),
+					Data: make([][]float64, af.NumChannels),
+				},
+			})
+			index = len(o.Files) - 1
+			af.hostOwned = uintptr(index + 1)
+		}
+		o.Files[index].Flags |= af.Flags
+		if !contains(o.requested, index) {
+			o.requested = append(o.requested, index)
+		}
+	}
+	return true
+}
+
+// read handles HostOfflineRead.
+func (o *Offline) read(task *OfflineTask, option OfflineOption, source bool) bool {
+	f := o.file(task)
+	if f == nil {
+		return false
+	}
+	switch option {
+	case OfflineAudioOption:
+		audio := f.Source
+		if !source {
+			audio = f.Destination
+		}
+		b, ok := o.buffers[int(task.hostOwned)-1]
+		if audio == nil || !ok || audio.Channels() != int(task.NumSourceChannels) {
+			return false
+		}
+		// plugin can change the task after buffers are allocated.
+		interleaved := task.Flags&OfflineInterleavedAudio != 0
+		frames := int(task.ReadCount)
+		if frames < 0 || frames > bufferCapacity(b.in, audio.Channels(), interleaved) {
+			task.ReadCount = 0
+			return false
+		}
+		scratch := o.scratchBuffer(audio.Channels(), frames)
+		read, err := audio.ReadAt(scratch, int(task.ReadPosition))
+		if err != nil {
+			return false
+		}
+		for c := range scratch {
+			for i, v := range scratch[c][:read] {
+				if interleaved {
+					b.in.Channel(0)[i*len(scratch)+c] = float32(v)
+				} else {
+					b.in.Channel(c)[i] = float32(v)
+				}
+			}
+		}
+		task.ReadCount = int32(read)
+	case OfflineMarkerOption:
+		if len(f.Markers) == 0 {
+			task.extraBuffer, task.Value = nil, 0
+			return true
+		}
+		mem := o.allocate(len(f.Markers), unsafe.Sizeof(AudioFileMarker{}))
+		copy((*[1 << 16]AudioFileMarker)(mem)[:len(f.Markers)], f.Markers)
+		task.extraBuffer, task.Value = mem, int32(len(f.Markers))
+	case OfflineCursorOption:
+		task.PositionToProcessFrom = float64(f.Cursor)
+	case OfflineSelectionOption:
+		task.PositionToProcessFrom = float64(f.SelectionStart)
+		task.NumFramesToProcess = float64(f.SelectionSize)
+	default:
+		return false
+	}
+	return true
+}
+
+// write handles HostOfflineWrite.
+func (o *Offline) write(task *OfflineTask, option OfflineOption) bool {
+	f := o.file(task)
+	if f == nil {
+		return false
+	}
+	switch option {
+	case OfflineAudioOption:
+		b, ok := o.buffers[int(task.hostOwned)-1]
+		if !ok || f.Flags&AudioFileReadOnly != 0 {
+			return false
+		}
+		if f.Destination == nil {
+			f.Destination = &MemoryAudio{
+				Rate: signal.Frequency(task.DestinationSampleRate),
+				Data: make([][]float64, task.NumDestinationChannels),
+			}
+		}
+		// plugin can change the task after buffers are allocated.
+		interleaved := task.Flags&OfflineInterleavedAudio != 0
+		channels := int(task.NumDestinationChannels)
+		frames := int(task.WriteCount)
+		if frames < 0 || frames > bufferCapacity(b.out, channels, interleaved) {
+			task.WriteCount = 0
+			return false
+		}
+		scratch := o.scratchBuffer(channels, frames)
+		for c := range scratch {
+			for i := range scratch[c] {
+				if interleaved {
+					scratch[c][i] = float64(b.out.Channel(0)[i*channels+c])
+				} else {
+					scratch[c][i] = float64(b.out.Channel(c)[i])
+				}
+			}
+		}
+		written, err := f.Destination.WriteAt(scratch, int(task.WritePosition))
+		if err != nil {
+			return false
+		}
+		task.WriteCount = int32(written)
+	case OfflineMarkerOption:
+		if task.extraBuffer == nil {
+			return false
+		}
+		for _, m := range (*[1 << 16]AudioFileMarker)(task.extraBuffer)[:task.Value:task.Value] {
+			f.setMarker(m)
+		}
+	case OfflineCursorOption:
+		f.Cursor = int(task.PositionToProcessFrom)
+	case OfflineSelectionOption:
+		f.SelectionStart = int(task.PositionToProcessFrom)
+		f.SelectionSize = int(task.NumFramesToProcess)
+	default:
+		return false
+	}
+	return true
+}
+
+// file returns the file of the task.
+func (o *Offline) file(task *OfflineTask) *OfflineFile {
+	if task == nil {
+		return nil
+	}
+	index := int(task.hostOwned) - 1
+	if index < 0 || index >= len(o.Files) {
+		return nil
+	}
+	return o.Files[index]
+}
+
+// scratchBuffer returns the buffer for samples conversion.
+func (o *Offline) scratchBuffer(channels, frames int) [][]float64 {
+	if len(o.scratch) < channels {
+		o.scratch = append(o.scratch, make([][]float64, channels-len(o.scratch))...)
+	}
+	for c := range o.scratch[:channels] {
+		if cap(o.scratch[c]) < frames {
+			o.scratch[c] = make([]float64, frames)
+		}
+		o.scratch[c] = o.scratch[c][:frames]
+	}
+	return o.scratch[:channels]
+}
+
+// allocate returns zeroed C memory for n elements of provided size. The
+// memory is freed after the run.
+func (o *Offline) allocate(n int, size uintptr) unsafe.Pointer {
+	if n == 0 {
+		n = 1
+	}
+	mem := C.calloc(C.size_t(n), C.size_t(size))
+	o.allocated = append(o.allocated, mem)
+	return mem
+}
+
+// free releases the memory allocated for the run.
+func (o *Offline) free() {
+	for _, b := range o.buffers {
+		b.in.Free()
+		b.out.Free()
+	}
+	o.buffers = map[int]offlineBuffers{}
+	for _, mem := range o.allocated {
+		C.free(mem)
+	}
+	o.allocated = nil
+	o.files = nil
+}
+
+func (o *Offline) bufferSize() int {
+	if o.BufferSize > 0 {
+		return o.BufferSize
+	}
+	return DefaultOfflineBufferSize
+}
+
+// audio returns the audio that describes the file dimensions.
+func (f *OfflineFile) audio() OfflineAudio {
+	if f.Source != nil {
+		return f.Source
+	}
+	return f.Destination
+}
+
+// setMarker replaces the marker with the same ID or adds a new one.
+func (f *OfflineFile) setMarker(m AudioFileMarker) {
+	for i := range f.Markers {
+		if f.Markers[i].ID == m.ID {
+			f.Markers[i] = m
+			return
+		}
+	}
+	f.Markers = append(f.Markers, m)
+}
+
+// taskError returns the error reported by plugin in the tasks.
+func taskError(tasks []OfflineTask) error {
+	for i := range tasks {
+		if tasks[i].Flags&(OfflinePluginError|OfflineInvalidParameter) == 0 {
+			continue
+		}
+		if text := tasks[i].OutputText.String(); text != "" {
+			return fmt.Errorf("offline task %d failed: %s", i, text)
+		}
+		return fmt.Errorf("offline task %d failed", i)
+	}
+	return nil
+}
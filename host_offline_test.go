@@ -0,0 +1,127 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestOffline(t *testing.T) {
+	t.Parallel()
+	source := &MemoryAudio{
+		Rate: 44100,
+		Data: [][]float64{{1, 2, 3, 4}, {5, 6, 7, 8}},
+	}
+	o := &Offline{
+		Files:   []*OfflineFile{{Name: "test", Source: source, SelectionStart: 1, SelectionSize: 2}},
+		buffers: map[int]offlineBuffers{},
+	}
+	defer o.free()
+	callback := Host{
+		OfflineStart: o.start,
+		OfflineRead:  o.read,
+		OfflineWrite: o.write,
+	}.Callback()
+
+	files := o.audioFiles()
+	assertEqual(t, "file name", files[0].Name.String(), "test")
+	assertEqual(t, "file channels", files[0].NumChannels, int32(2))
+
+	// plugin requests the file and creates a new one.
+	requested := make([]AudioFile, 2)
+	requested[0] = files[0]
+	requested[0].Flags = AudioFileWantRead | AudioFileWantWrite
+	requested[1].SetName("new")
+	requested[1].NumChannels = 1
+	requested[1].SampleRate = 44100
+	assertEqual(t, "start", callback(HostOfflineStart, 1, 2, unsafe.Pointer(&requested[0]), 0), int64(1))
+	assertEqual(t, "files", len(o.Files), 2)
+	assertEqual(t, "new file", o.Files[1].Name, "new")
+	assertEqual(t, "requested", o.requested, []int{0, 1})
+
+	tasks := o.tasks(o.requested)
+	assertEqual(t, "process from", tasks[0].PositionToProcessFrom, 1.0)
+	assertEqual(t, "frames to process", tasks[0].NumFramesToProcess, 2.0)
+	assertEqual(t, "new file flag", tasks[1].Flags&OfflineNewFile, OfflineNewFile)
+	tasks[1].Flags |= OfflineInterleavedAudio
+	o.allocateBuffers(tasks)
+
+	t.Run("audio", func(t *testing.T) {
+		task := &tasks[0]
+		task.ReadPosition, task.ReadCount = 1, 10
+		assertEqual(t, "read", callback(HostOfflineRead, 1, int64(OfflineAudioOption), unsafe.Pointer(task), 0), int64(1))
+		assertEqual(t, "read count", task.ReadCount, int32(3))
+		in := o.buffers[0].in
+		assertEqual(t, "read samples", in.Channel(1)[:3], []float32{6, 7, 8})
+
+		out := o.buffers[0].out
+		copy(out.Channel(0), []float32{10, 20})
+		copy(out.Channel(1), []float32{30, 40})
+		task.WritePosition, task.WriteCount = 2, 2
+		assertEqual(t, "write", callback(HostOfflineWrite, 0, int64(OfflineAudioOption), unsafe.Pointer(task), 0), int64(1))
+		assertEqual(t, "destination", o.Files[0].Destination.(*MemoryAudio).Data, [][]float64{{0, 0, 10, 20}, {0, 0, 30, 40}})
+		assertEqual(t, "source is not modified", source.Data[0], []float64{1, 2, 3, 4})
+
+		task = &tasks[1]
+		copy(o.buffers[1].out.Channel(0), []float32{1, 2, 3})
+		task.WriteCount = 3
+		assertEqual(t, "interleaved write", callback(HostOfflineWrite, 0, int64(OfflineAudioOption), unsafe.Pointer(task), 0), int64(1))
+		assertEqual(t, "new file destination", o.Files[1].Destination.(*MemoryAudio).Data, [][]float64{{1, 2, 3}})
+
+		// counts are set by plugin and must fit the buffers.
+		task = &tasks[0]
+		for _, count := range []int32{-1, task.SizeInputBuffer + 1} {
+			task.ReadCount = count
+			assertEqual(t, "invalid read", callback(HostOfflineRead, 1, int64(OfflineAudioOption), unsafe.Pointer(task), 0), int64(0))
+			assertEqual(t, "invalid read count", task.ReadCount, int32(0))
+			task.WriteCount = count
+			assertEqual(t, "invalid write", callback(HostOfflineWrite, 0, int64(OfflineAudioOption), unsafe.Pointer(task), 0), int64(0))
+			assertEqual(t, "invalid write count", task.WriteCount, int32(0))
+		}
+	})
+
+	t.Run("markers and cursor", func(t *testing.T) {
+		task := &tasks[0]
+		markers := make([]AudioFileMarker, 2)
+		markers[0].ID, markers[0].Position = 1, 2
+		markers[0].SetName("first")
+		markers[1].ID, markers[1].Position = 2, 3
+		task.extraBuffer, task.Value = unsafe.Pointer(&markers[0]), 2
+		assertEqual(t, "write markers", o.write(task, OfflineMarkerOption), true)
+		markers[0].Position = 1
+		task.Value = 1
+		assertEqual(t, "update marker", o.write(task, OfflineMarkerOption), true)
+		assertEqual(t, "markers", len(o.Files[0].Markers), 2)
+		assertEqual(t, "marker position", o.Files[0].Markers[0].Position, 1.0)
+
+		assertEqual(t, "read markers", o.read(task, OfflineMarkerOption, true), true)
+		assertEqual(t, "markers count", task.Value, int32(2))
+		read := (*[2]AudioFileMarker)(task.extraBuffer)
+		assertEqual(t, "marker name", read[0].Name.String(), "first")
+
+		task.PositionToProcessFrom = 3
+		assertEqual(t, "move cursor", o.write(task, OfflineCursorOption), true)
+		assertEqual(t, "cursor", o.Files[0].Cursor, 3)
+		assertEqual(t, "unsupported option", o.read(task, OfflinePeaksOption, true), false)
+	})
+}
+
+func TestMemoryAudio(t *testing.T) {
+	t.Parallel()
+	a := &MemoryAudio{Data: make([][]float64, 1)}
+	n, err := a.WriteAt([][]float64{{1, 2}}, 1)
+	assertEqual(t, "write error", err, nil)
+	assertEqual(t, "written", n, 2)
+	assertEqual(t, "frames", a.Frames(), 3)
+
+	dst := [][]float64{make([]float64, 4)}
+	n, err = a.ReadAt(dst, 1)
+	assertEqual(t, "read error", err, nil)
+	assertEqual(t, "read", n, 2)
+	assertEqual(t, "samples", dst[0][:n], []float64{1, 2})
+
+	_, err = a.ReadAt(make([][]float64, 2), 0)
+	assertEqual(t, "channels mismatch", err != nil, true)
+}
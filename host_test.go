@@ -194,6 +194,107 @@ func TestDemoPlugin(t *testing.T) {
 		}
 	})
 
+	t.Run("precision", func(t *testing.T) {
+		t.Parallel()
+		const (
+			channels = 2
+			frames   = 16
+		)
+		tests := []struct {
+			policy   vst2.PrecisionPolicy
+			expected vst2.ProcessPrecision
+		}{
+			{vst2.PreferDouble, vst2.ProcessDouble},
+			{vst2.PreferFloat, vst2.ProcessFloat},
+			{vst2.ForceDouble, vst2.ProcessDouble},
+			{vst2.ForceFloat, vst2.ProcessFloat},
+		}
+		for _, test := range tests {
+			p := v.Plugin(vst2.NoopHostCallback())
+			p.Start()
+			p.SetSampleRate(44100)
+			p.SetBufferSize(frames)
+			assertEqual(t, "precision", p.SetPrecision(test.policy), test.expected)
+			assertEqual(t, "negotiated precision", p.Precision(), test.expected)
+			p.Resume()
+
+			doubleIn := vst2.NewDoubleBuffer(channels, frames)
+			doubleOut := vst2.NewDoubleBuffer(channels, frames)
+			floatIn := vst2.NewFloatBuffer(channels, frames)
+			floatOut := vst2.NewFloatBuffer(channels, frames)
+			for c := 0; c < channels; c++ {
+				for i := 0; i < frames; i++ {
+					doubleIn.Channel(c)[i] = 0.25
+					floatIn.Channel(c)[i] = 0.25
+				}
+			}
+			// unity gain with default parameter value.
+			p.ProcessDouble(doubleIn, doubleOut)
+			p.ProcessFloat(floatIn, floatOut)
+			for c := 0; c < channels; c++ {
+				for i := 0; i < frames; i++ {
+					assertEqual(t, "double output", doubleOut.Channel(c)[i], 0.25)
+					assertEqual(t, "float output", floatOut.Channel(c)[i], float32(0.25))
+				}
+			}
+			doubleIn.Free()
+			doubleOut.Free()
+			floatIn.Free()
+			floatOut.Free()
+			p.Suspend()
+			p.Close()
+		}
+	})
+
+	t.Run("forced precision fallback", func(t *testing.T) {
+		t.Parallel()
+		const (
+			channels = 2
+			frames   = 16
+		)
+		p := v.Plugin(vst2.NoopHostCallback())
+		defer p.Close()
+		vst2.RemoveProcessDouble(p)
+		p.Start()
+		p.SetSampleRate(44100)
+		p.SetBufferSize(frames)
+		assertEqual(t, "precision", p.SetPrecision(vst2.ForceDouble), vst2.ProcessFloat)
+		p.Resume()
+		defer p.Suspend()
+
+		in := vst2.NewDoubleBuffer(channels, frames)
+		defer in.Free()
+		out := vst2.NewDoubleBuffer(channels, frames)
+		defer out.Free()
+		for c := 0; c < channels; c++ {
+			for i := 0; i < frames; i++ {
+				in.Channel(c)[i] = 0.25
+			}
+		}
+		p.ProcessDouble(in, out)
+		for c := 0; c < channels; c++ {
+			for i := 0; i < frames; i++ {
+				assertEqual(t, "output", out.Channel(c)[i], 0.25)
+			}
+		}
+	})
+
+	t.Run("offline", func(t *testing.T) {
+		t.Parallel()
+		o := v.Offline(vst2.Host{}, &vst2.OfflineFile{
+			Name: "test",
+			Source: &vst2.MemoryAudio{
+				Rate: 44100,
+				Data: [][]float64{{1, 2, 3}, {4, 5, 6}},
+			},
+		})
+		defer o.Close()
+		// demo plugin doesn't support offline processing.
+		if err := o.Run(); err == nil {
+			t.Fatal("expected offline error")
+		}
+	})
+
 	t.Run("editor", func(t *testing.T) {
 		t.Parallel()
 		p := v.Plugin(vst2.NoopHostCallback())
@@ -357,6 +458,9 @@ func TestHostCallback(t *testing.T) {
 		p.SetSampleRate(sampleRate)
 		p.SetBufferSize(bufferSize)
 		p.Resume()
+		p.StartProcess()
+		p.StopProcess()
+		p.Suspend()
 	})
 
 	t.Run("send events", func(t *testing.T) {
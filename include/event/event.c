@@ -21,6 +21,19 @@ Events* newEvents(int32_t numEvents) {
 	return e;
 }
 
+Events* newEventsBuffer(int32_t capacity, size_t eventSize) {
+	size_t header = sizeof(Events) + sizeof(void *) * capacity;
+	Events *e = calloc(1, header + eventSize * capacity);
+	if (e == NULL) {
+		return NULL;
+	}
+	char *storage = (char *)e + header;
+	for (int32_t i = 0; i < capacity; i++) {
+		e->events[i] = storage + eventSize * i;
+	}
+	return e;
+}
+
 void setEvent(Events *events, void *event, int32_t pos) {
 	events->events[pos] = event;
 }
@@ -1,4 +1,5 @@
 #include <stdlib.h>
+#include <string.h>
 #include "include/vst.h"
 
 //Go callback prototype
@@ -14,13 +15,27 @@ int64_t dispatchHostBridge(CPlugin *plugin, int32_t opcode, int32_t index, int64
 	return plugin->dispatcher(plugin, opcode, index, value, ptr, opt);
 }
 
-// Bridge to call process replacing function of loaded plugin
+// Bridge to call process replacing function of loaded plugin. Outputs
+// are silenced if plugin doesn't implement it.
 void processDoubleHostBridge(CPlugin *plugin, double ** inputs, double ** outputs, int32_t sampleFrames){
+	if (plugin->processDouble == NULL) {
+		for (int32_t c = 0; c < plugin->numOutputs; c++) {
+			memset(outputs[c], 0, sizeof(double) * sampleFrames);
+		}
+		return;
+	}
 	plugin -> processDouble(plugin, inputs, outputs, sampleFrames);
 }
 
-// Bridge to call process replacing function of loaded plugin
+// Bridge to call process replacing function of loaded plugin. Outputs
+// are silenced if plugin doesn't implement it.
 void processFloatHostBridge(CPlugin *plugin, float **inputs, float **outputs, int32_t sampleFrames){
+	if (plugin->processFloat == NULL) {
+		for (int32_t c = 0; c < plugin->numOutputs; c++) {
+			memset(outputs[c], 0, sizeof(float) * sampleFrames);
+		}
+		return;
+	}
 	plugin -> processFloat(plugin, inputs, outputs, sampleFrames);
 }
 
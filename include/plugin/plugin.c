@@ -35,6 +35,15 @@ VSTAPI CPlugin* VSTPluginMain(HostCallback c) {
     return p;
 }
 
+// Go instance handle is kept in the object field.
+void setPluginHandle(CPlugin *plugin, uintptr_t handle) {
+    plugin->object = (void*)handle;
+}
+
+uintptr_t getPluginHandle(CPlugin *plugin) {
+    return (uintptr_t)plugin->object;
+}
+
 int64_t callbackHost(HostCallback c, CPlugin* plugin, int32_t opcode, int32_t index, int64_t value, void* ptr, float opt) {
     return c(plugin, opcode, index, value, ptr, opt);
 };
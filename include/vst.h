@@ -1,6 +1,7 @@
 #ifndef VST_H
 #define VST_H
 #include <stdint.h>
+#include <stddef.h>
 
 typedef struct CPlugin CPlugin;
 typedef struct Events Events;
@@ -91,6 +92,12 @@ struct Events
 // Bridge to allocate events structure.
 Events* newEvents(int32_t numEvents);
 
+// Bridge to allocate events structure together with storage for the
+// events of provided size. Event pointers are set to the storage and the
+// number of events is zero. Structure is released with a single free.
+// Returns NULL if memory can't be allocated.
+Events* newEventsBuffer(int32_t capacity, size_t eventSize);
+
 // sets event into events array. This function is needed because there is
 // no way to assign values to void** from Go.
 void setEvent(Events *events, void *event, int32_t pos);
@@ -0,0 +1,224 @@
+package vst2
+
+import "fmt"
+
+// MIDI status bytes of channel messages. Lower nibble is the channel.
+const (
+	midiNoteOff         = 0x80
+	midiNoteOn          = 0x90
+	midiPolyPressure    = 0xA0
+	midiControlChange   = 0xB0
+	midiProgramChange   = 0xC0
+	midiChannelPressure = 0xD0
+	midiPitchBend       = 0xE0
+)
+
+// MIDI system real-time messages.
+const (
+	MIDITimingClock   RealTime = 0xF8
+	MIDIStart         RealTime = 0xFA
+	MIDIContinue      RealTime = 0xFB
+	MIDIStop          RealTime = 0xFC
+	MIDIActiveSensing RealTime = 0xFE
+	MIDISystemReset   RealTime = 0xFF
+)
+
+const (
+	// PitchBendMin is the lowest pitch bend value.
+	PitchBendMin = -8192
+	// PitchBendMax is the highest pitch bend value.
+	PitchBendMax = 8191
+)
+
+type (
+	// MIDIMessage is a typed MIDI message. Every message is encoded with
+	// its own status byte, running status is never used. Channel is in
+	// range [0, 15] and data values are in range [0, 127]. Values out of
+	// range are clamped on encoding, so they never wrap to other channels
+	// or values.
+	MIDIMessage interface {
+		// Data returns the encoded message.
+		Data() [3]byte
+	}
+
+	// NoteOn starts the note.
+	NoteOn struct {
+		Channel  uint8
+		Key      uint8
+		Velocity uint8
+	}
+
+	// NoteOff stops the note.
+	NoteOff struct {
+		Channel  uint8
+		Key      uint8
+		Velocity uint8
+	}
+
+	// PolyPressure is the aftertouch of a single key.
+	PolyPressure struct {
+		Channel  uint8
+		Key      uint8
+		Pressure uint8
+	}
+
+	// ControlChange sets the controller value.
+	ControlChange struct {
+		Channel    uint8
+		Controller uint8
+		Value      uint8
+	}
+
+	// ProgramChange selects the program.
+	ProgramChange struct {
+		Channel uint8
+		Program uint8
+	}
+
+	// ChannelPressure is the aftertouch of the whole channel.
+	ChannelPressure struct {
+		Channel  uint8
+		Pressure uint8
+	}
+
+	// PitchBend is 14-bit pitch wheel position. Value is in range
+	// [PitchBendMin, PitchBendMax], zero is the center.
+	PitchBend struct {
+		Channel uint8
+		Value   int16
+	}
+
+	// RealTime is the system real-time message.
+	RealTime uint8
+)
+
+// NewMIDIEvent returns MIDI event with encoded message.
+func NewMIDIEvent(deltaFrames int32, m MIDIMessage) *MIDIEvent {
+	return &MIDIEvent{
+		DeltaFrames: deltaFrames,
+		Data:        m.Data(),
+	}
+}
+
+// Decode returns the typed message of the event. NoteOn with zero
+// velocity is decoded as NoteOff.
+func (e *MIDIEvent) Decode() (MIDIMessage, error) {
+	return DecodeMIDI(e.Data)
+}
+
+// DecodeMIDI returns the typed message of encoded data. NoteOn with zero
+// velocity is decoded as NoteOff. Data values are clamped to 127.
+func DecodeMIDI(data [3]byte) (MIDIMessage, error) {
+	status := data[0]
+	if status < 0x80 {
+		return nil, fmt.Errorf("missing status byte: %#x", status)
+	}
+	channel := status & 0x0F
+	d1, d2 := clampData(data[1]), clampData(data[2])
+	switch status & 0xF0 {
+	case midiNoteOff:
+		return NoteOff{Channel: channel, Key: d1, Velocity: d2}, nil
+	case midiNoteOn:
+		if d2 == 0 {
+			return NoteOff{Channel: channel, Key: d1}, nil
+		}
+		return NoteOn{Channel: channel, Key: d1, Velocity: d2}, nil
+	case midiPolyPressure:
+		return PolyPressure{Channel: channel, Key: d1, Pressure: d2}, nil
+	case midiControlChange:
+		return ControlChange{Channel: channel, Controller: d1, Value: d2}, nil
+	case midiProgramChange:
+		return ProgramChange{Channel: channel, Program: d1}, nil
+	case midiChannelPressure:
+		return ChannelPressure{Channel: channel, Pressure: d1}, nil
+	case midiPitchBend:
+		return PitchBend{Channel: channel, Value: (int16(d1) | int16(d2)<<7) + PitchBendMin}, nil
+	}
+	switch r := RealTime(status); r {
+	case MIDITimingClock, MIDIStart, MIDIContinue, MIDIStop, MIDIActiveSensing, MIDISystemReset:
+		return r, nil
+	}
+	return nil, fmt.Errorf("unsupported status byte: %#x", status)
+}
+
+// Data returns the encoded message.
+func (m NoteOn) Data() [3]byte {
+	return channelMessage(midiNoteOn, m.Channel, m.Key, m.Velocity)
+}
+
+// Data returns the encoded message.
+func (m NoteOff) Data() [3]byte {
+	return channelMessage(midiNoteOff, m.Channel, m.Key, m.Velocity)
+}
+
+// Data returns the encoded message.
+func (m PolyPressure) Data() [3]byte {
+	return channelMessage(midiPolyPressure, m.Channel, m.Key, m.Pressure)
+}
+
+// Data returns the encoded message.
+func (m ControlChange) Data() [3]byte {
+	return channelMessage(midiControlChange, m.Channel, m.Controller, m.Value)
+}
+
+// Data returns the encoded message.
+func (m ProgramChange) Data() [3]byte {
+	return channelMessage(midiProgramChange, m.Channel, m.Program, 0)
+}
+
+// Data returns the encoded message.
+func (m ChannelPressure) Data() [3]byte {
+	return channelMessage(midiChannelPressure, m.Channel, m.Pressure, 0)
+}
+
+// Data returns the encoded message. Values out of range are clamped.
+func (m PitchBend) Data() [3]byte {
+	v := m.Value
+	if v < PitchBendMin {
+		v = PitchBendMin
+	} else if v > PitchBendMax {
+		v = PitchBendMax
+	}
+	u := uint16(v - PitchBendMin)
+	return channelMessage(midiPitchBend, m.Channel, uint8(u&0x7F), uint8(u>>7))
+}
+
+// Data returns the encoded message.
+func (m RealTime) Data() [3]byte {
+	return [3]byte{byte(m)}
+}
+
+func (m RealTime) String() string {
+	switch m {
+	case MIDITimingClock:
+		return "TimingClock"
+	case MIDIStart:
+		return "Start"
+	case MIDIContinue:
+		return "Continue"
+	case MIDIStop:
+		return "Stop"
+	case MIDIActiveSensing:
+		return "ActiveSensing"
+	case MIDISystemReset:
+		return "SystemReset"
+	}
+	return fmt.Sprintf("RealTime(%#x)", uint8(m))
+}
+
+// channelMessage encodes channel message. Channel is clamped to 15 and
+// data values are clamped to 127.
+func channelMessage(status, channel, d1, d2 uint8) [3]byte {
+	if channel > 0x0F {
+		channel = 0x0F
+	}
+	return [3]byte{status | channel, clampData(d1), clampData(d2)}
+}
+
+// clampData clamps MIDI data value to 127.
+func clampData(v uint8) uint8 {
+	if v > 0x7F {
+		return 0x7F
+	}
+	return v
+}
@@ -0,0 +1,120 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import "sync/atomic"
+
+// DefaultCaptureSize is the default number of buffered captured events.
+const DefaultCaptureSize = 1024
+
+// captureCanDo are capabilities reported by host with capture.
+var captureCanDo = []HostCanDoString{HostCanReceiveEvents, HostCanReceiveMIDIEvent}
+
+// MIDICapture collects events sent by plugin to the host. Plugin events
+// are only valid during the callback, so capture copies them, including
+// SysEx dumps, and stamps them with the absolute sample position.
+type MIDICapture struct {
+	// position, factor and dropped are accessed atomically.
+	position int64
+	// factor is the oversampling factor of event deltas.
+	factor  int64
+	dropped int64
+	events  chan TimedEvent
+}
+
+// NewMIDICapture returns capture that buffers provided number of events.
+// DefaultCaptureSize is used if size is not positive.
+func NewMIDICapture(size int) *MIDICapture {
+	if size <= 0 {
+		size = DefaultCaptureSize
+	}
+	return &MIDICapture{
+		events: make(chan TimedEvent, size),
+	}
+}
+
+// Host returns provided host with ProcessEvents callback wrapped to
+// capture events. Host reports that it can receive events and MIDI
+// events.
+func (c *MIDICapture) Host(h Host) Host {
+	h.CanDo = supportCanDo(h.CanDo, captureCanDo...)
+	processEvents := h.ProcessEvents
+	h.ProcessEvents = func(events *EventsPtr) {
+		c.capture(events)
+		if processEvents != nil {
+			processEvents(events)
+		}
+	}
+	return h
+}
+
+// SetPosition sets the absolute sample position of the block that is
+// processed next. Captured events are positioned relative to it.
+// Processor, Graph and MIDIRender set it before every block.
+func (c *MIDICapture) SetPosition(position int64) {
+	c.setBlock(position, 1)
+}
+
+// setBlock sets the position of the next block and the factor that event
+// deltas are divided by.
+func (c *MIDICapture) setBlock(position int64, factor int) {
+	atomic.StoreInt64(&c.position, position)
+	atomic.StoreInt64(&c.factor, int64(factor))
+}
+
+// canDo wraps CanDo callback to report capture capabilities if capture
+// is set.
+func (c *MIDICapture) canDo(fn HostCanDoFunc) HostCanDoFunc {
+	if c == nil {
+		return fn
+	}
+	return supportCanDo(fn, captureCanDo...)
+}
+
+// Events returns the channel of captured events. SysEx dumps of received
+// events must be freed after use.
+func (c *MIDICapture) Events() <-chan TimedEvent {
+	return c.events
+}
+
+// Dropped returns the number of events that were dropped because the
+// buffer was full.
+func (c *MIDICapture) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+// capture copies events into the buffer without blocking. Events that
+// don't fit the buffer are dropped.
+func (c *MIDICapture) capture(events *EventsPtr) {
+	if events == nil {
+		return
+	}
+	position := atomic.LoadInt64(&c.position)
+	factor := atomic.LoadInt64(&c.factor)
+	if factor < 1 {
+		factor = 1
+	}
+	for i := 0; i < events.NumEvents(); i++ {
+		var e TimedEvent
+		switch ev := events.Event(i).(type) {
+		case *MIDIEvent:
+			m := *ev
+			e = TimedEvent{Position: position + int64(m.DeltaFrames)/factor, Event: &m}
+		case *SysExMIDIEvent:
+			m := *ev
+			m.SysExDump = SysExData(ev.SysExDump.Bytes())
+			e = TimedEvent{Position: position + int64(m.DeltaFrames)/factor, Event: &m}
+		default:
+			continue
+		}
+		select {
+		case c.events <- e:
+		default:
+			atomic.AddInt64(&c.dropped, 1)
+			if m, ok := e.Event.(*SysExMIDIEvent); ok {
+				m.SysExDump.Free()
+			}
+		}
+	}
+}
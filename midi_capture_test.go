@@ -0,0 +1,69 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2_test
+
+import (
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+func TestMIDICapture(t *testing.T) {
+	t.Parallel()
+	t.Run("can do", func(t *testing.T) {
+		t.Parallel()
+		c := vst2.NewMIDICapture(0)
+		h := c.Host(vst2.Host{
+			CanDo: func(s vst2.HostCanDoString) vst2.CanDoResponse {
+				return vst2.NoCanDo
+			},
+		})
+		assertEqual(t, "midi", h.CanDo(vst2.HostCanReceiveMIDIEvent), vst2.YesCanDo)
+		assertEqual(t, "events", h.CanDo(vst2.HostCanReceiveEvents), vst2.YesCanDo)
+		assertEqual(t, "other", h.CanDo(vst2.HostCanSendMIDIEvent), vst2.NoCanDo)
+	})
+
+	t.Run("capture", func(t *testing.T) {
+		t.Parallel()
+		c := vst2.NewMIDICapture(0)
+		var forwarded int
+		h := c.Host(vst2.Host{
+			ProcessEvents: func(events *vst2.EventsPtr) {
+				forwarded += events.NumEvents()
+			},
+		})
+
+		dump := vst2.SysExData([]byte{0xF0, 0x7E, 0xF7})
+		note := vst2.NewMIDIEvent(3, vst2.NoteOn{Key: 60, Velocity: 100})
+		sysex := &vst2.SysExMIDIEvent{DeltaFrames: 7, SysExDump: dump}
+		c.SetPosition(512)
+		events := vst2.Events(note, sysex)
+		h.ProcessEvents(events)
+		// events are only valid during the callback.
+		events.Free()
+		dump.Free()
+		note.Data = [3]byte{}
+
+		assertEqual(t, "forwarded", forwarded, 2)
+		e := <-c.Events()
+		assertEqual(t, "note position", e.Position, int64(515))
+		assertEqual(t, "note data", e.Event.(*vst2.MIDIEvent).Data, vst2.NoteOn{Key: 60, Velocity: 100}.Data())
+		e = <-c.Events()
+		assertEqual(t, "sysex position", e.Position, int64(519))
+		captured := e.Event.(*vst2.SysExMIDIEvent).SysExDump
+		defer captured.Free()
+		assertEqual(t, "sysex data", captured.Bytes(), []byte{0xF0, 0x7E, 0xF7})
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		t.Parallel()
+		c := vst2.NewMIDICapture(1)
+		h := c.Host(vst2.Host{})
+		events := vst2.Events(&vst2.MIDIEvent{}, &vst2.MIDIEvent{}, &vst2.MIDIEvent{})
+		defer events.Free()
+		h.ProcessEvents(events)
+		assertEqual(t, "dropped", c.Dropped(), int64(2))
+		assertEqual(t, "buffered", len(c.Events()), 1)
+	})
+}
@@ -0,0 +1,133 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"errors"
+
+	"pipelined.dev/signal"
+)
+
+// DefaultRenderBufferSize is the block size of MIDI render.
+const DefaultRenderBufferSize = 512
+
+type (
+	// MIDIRender renders timed events with instrument plugin offline.
+	MIDIRender struct {
+		SampleRate signal.Frequency
+		// BufferSize is the number of frames per process call.
+		// DefaultRenderBufferSize is used if zero.
+		BufferSize int
+		// TailThreshold is the absolute sample value below which the
+		// tail is considered silent. DefaultTailThreshold is used if
+		// zero.
+		TailThreshold float64
+		// TailHold is the number of continuous silent frames that ends
+		// the tail. DefaultTailHold seconds are used if zero.
+		TailHold int
+		// MaxTail limits the tail length in frames. DefaultMaxTail
+		// seconds are used if zero.
+		MaxTail int
+		// Capture receives events sent by the plugin. Render updates
+		// the capture position before every block. Plugin must be
+		// created with the render Host.
+		Capture *MIDICapture
+	}
+
+	// RenderFunc receives the rendered block. Buffer is valid until the
+	// function returns.
+	RenderFunc func(out DoubleBuffer) error
+)
+
+// Host returns provided host with CanDo callback wrapped to report start
+// and stop process support, because the render starts and stops the
+// processing. If Capture is set, host is also wrapped with Capture.Host.
+func (r MIDIRender) Host(h Host) Host {
+	h.CanDo = supportCanDo(h.CanDo, HostCanStartStopProcess)
+	if r.Capture != nil {
+		h = r.Capture.Host(h)
+	}
+	return h
+}
+
+// Render processes events with the started plugin. Events are delivered
+// with DeltaFrames relative to the block that contains their position.
+// After length frames, the plugin tail is rendered. If plugin reports
+// the tail size, it's rendered completely. Otherwise rendering stops when
+// the output stays below the threshold for the hold frames. Plugin should be created
+// with the render Host.
+func (r MIDIRender) Render(p *Plugin, events []TimedEvent, length int64, fn RenderFunc) error {
+	if r.SampleRate <= 0 {
+		return errors.New("sample rate is not set")
+	}
+	bufferSize := r.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultRenderBufferSize
+	}
+	detector := newTailDetector(r.TailThreshold, r.TailHold, r.SampleRate)
+	maxTail := int64(r.MaxTail)
+	if maxTail <= 0 {
+		maxTail = int64(DefaultMaxTail * r.SampleRate)
+	}
+
+	p.SetSampleRate(r.SampleRate)
+	p.SetBufferSize(bufferSize)
+	p.Resume()
+	p.StartProcess()
+	defer p.Suspend()
+	defer p.StopProcess()
+
+	in := NewDoubleBuffer(p.NumInputs(), bufferSize)
+	defer in.Free()
+	out := NewDoubleBuffer(p.NumOutputs(), bufferSize)
+	defer out.Free()
+
+	scheduler := NewEventScheduler(len(events))
+	defer scheduler.Free()
+	scheduler.Schedule(events...)
+	end := length + maxTail
+	tailKnown := false
+	if tail := p.GetTailSize(); tail > 1 {
+		end, tailKnown = length+min64(int64(tail), maxTail), true
+	} else if tail == 1 {
+		// plugin has no tail.
+		end, tailKnown = length, true
+	}
+	for position := int64(0); position < end; {
+		limit := end
+		if position < length {
+			// tail starts right after the length.
+			limit = length
+		}
+		frames := int(min64(int64(bufferSize), limit-position))
+		if r.Capture != nil {
+			r.Capture.setBlock(position, 1)
+		}
+		if events := scheduler.Next(position, frames); events != nil {
+			p.SendEvents(events)
+		}
+		input, output := in, out
+		input.Frames, output.Frames = frames, frames
+		p.processZeroed(input, output)
+		done := false
+		if !tailKnown && position >= length {
+			output.Frames, done = detector.detect(output, 0, frames)
+		}
+		if err := fn(output); err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		position += int64(frames)
+	}
+	return nil
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
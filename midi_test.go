@@ -0,0 +1,70 @@
+package vst2_test
+
+import (
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+func TestMIDIMessages(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		message vst2.MIDIMessage
+		data    [3]byte
+	}{
+		{"note on", vst2.NoteOn{Channel: 1, Key: 60, Velocity: 100}, [3]byte{0x91, 60, 100}},
+		{"note off", vst2.NoteOff{Channel: 15, Key: 60, Velocity: 64}, [3]byte{0x8F, 60, 64}},
+		{"poly pressure", vst2.PolyPressure{Channel: 2, Key: 61, Pressure: 10}, [3]byte{0xA2, 61, 10}},
+		{"control change", vst2.ControlChange{Controller: 7, Value: 127}, [3]byte{0xB0, 7, 127}},
+		{"program change", vst2.ProgramChange{Channel: 9, Program: 5}, [3]byte{0xC9, 5, 0}},
+		{"channel pressure", vst2.ChannelPressure{Channel: 3, Pressure: 90}, [3]byte{0xD3, 90, 0}},
+		{"pitch bend center", vst2.PitchBend{}, [3]byte{0xE0, 0x00, 0x40}},
+		{"pitch bend min", vst2.PitchBend{Channel: 4, Value: vst2.PitchBendMin}, [3]byte{0xE4, 0x00, 0x00}},
+		{"pitch bend max", vst2.PitchBend{Value: vst2.PitchBendMax}, [3]byte{0xE0, 0x7F, 0x7F}},
+		{"timing clock", vst2.MIDITimingClock, [3]byte{0xF8}},
+		{"stop", vst2.MIDIStop, [3]byte{0xFC}},
+	}
+	for _, test := range tests {
+		e := vst2.NewMIDIEvent(10, test.message)
+		assertEqual(t, test.name+" delta", e.DeltaFrames, int32(10))
+		assertEqual(t, test.name+" data", e.Data, test.data)
+		decoded, err := e.Decode()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		assertEqual(t, test.name+" decoded", decoded, test.message)
+	}
+
+	t.Run("out of range", func(t *testing.T) {
+		t.Parallel()
+		m := vst2.NoteOn{Channel: 17, Key: 200, Velocity: 128}
+		assertEqual(t, "data", m.Data(), [3]byte{0x9F, 127, 127})
+		assertEqual(t, "last channel", vst2.ControlChange{Channel: 15}.Data(), [3]byte{0xBF, 0, 0})
+		decoded, err := vst2.DecodeMIDI([3]byte{0x90, 200, 128})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertEqual(t, "decoded", decoded, vst2.NoteOn{Key: 127, Velocity: 127})
+		m2 := vst2.PitchBend{Value: 10000}
+		assertEqual(t, "clamped", m2.Data(), [3]byte{0xE0, 0x7F, 0x7F})
+	})
+
+	t.Run("note on with zero velocity", func(t *testing.T) {
+		t.Parallel()
+		decoded, err := vst2.DecodeMIDI([3]byte{0x92, 60, 0})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertEqual(t, "note off", decoded, vst2.NoteOff{Channel: 2, Key: 60})
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, data := range [][3]byte{{0x40, 1, 2}, {0xF0}, {0xF9}} {
+			if _, err := vst2.DecodeMIDI(data); err == nil {
+				t.Fatalf("expected error for %v", data)
+			}
+		}
+	})
+}
@@ -0,0 +1,253 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+// Mixer parameters follow the plugin parameters. Parameter index is the
+// plugin NumParams plus the offset.
+const (
+	// MixParam is the dry/wet balance: 0 is dry, 1 is wet. Default is 1.
+	MixParam = iota
+	// InputTrimParam is the gain of plugin input in range
+	// [-MaxTrim, MaxTrim] dB. Default is 0.5 that is 0 dB.
+	InputTrimParam
+	// OutputTrimParam is the gain of mixed output in range
+	// [-MaxTrim, MaxTrim] dB. Default is 0.5 that is 0 dB.
+	OutputTrimParam
+	// PhaseInvertParam inverts the plugin output if value is 0.5 or
+	// higher. Default is 0.
+	PhaseInvertParam
+	numMixerParams
+)
+
+// MaxTrim is the range of trim parameters in dB.
+const MaxTrim = 24
+
+type (
+	// Mixer wraps the plugin with host-side dry/wet mix, input and
+	// output trim and phase invert. Mixer parameters are exposed after
+	// the plugin parameters, so they are automated the same way. The
+	// dry signal is delayed by the plugin latency.
+	Mixer struct {
+		plugin *Plugin
+		// params hold float32 bits of normalized values.
+		params [numMixerParams]uint32
+		// in is the trimmed plugin input.
+		in DoubleBuffer
+		// dry is the input delayed by the plugin latency.
+		dry delayLine
+		// dryInputs holds the input of dry signal for every output.
+		// inputs is the number of inputs it's built for.
+		dryInputs []int
+		inputs    int
+		// gains applied to the last block, used to ramp the changes.
+		gains mixerGains
+	}
+
+	mixerGains struct {
+		input, wet, dry, output float64
+	}
+)
+
+// Mixer returns the wrapper with dry/wet mix, trim and phase invert. Mixer
+// must be freed after use.
+func (p *Plugin) Mixer() *Mixer {
+	m := Mixer{plugin: p}
+	m.setParam(MixParam, 1)
+	m.setParam(InputTrimParam, 0.5)
+	m.setParam(OutputTrimParam, 0.5)
+	m.setParam(PhaseInvertParam, 0)
+	m.gains = m.targetGains()
+	return &m
+}
+
+// Plugin returns the wrapped plugin.
+func (m *Mixer) Plugin() *Plugin {
+	return m.plugin
+}
+
+// NumParams returns the number of plugin parameters with mixer
+// parameters.
+func (m *Mixer) NumParams() int {
+	return m.plugin.NumParams() + numMixerParams
+}
+
+// ParamValue returns the value of plugin or mixer parameter.
+func (m *Mixer) ParamValue(index int) float32 {
+	if i, ok := m.mixerParam(index); ok {
+		return m.param(i)
+	}
+	return m.plugin.ParamValue(index)
+}
+
+// SetParamValue sets the value of plugin or mixer parameter. It's safe to
+// set mixer parameters while the plugin is processed.
+func (m *Mixer) SetParamValue(index int, value float32) {
+	if i, ok := m.mixerParam(index); ok {
+		m.setParam(i, value)
+		return
+	}
+	m.plugin.SetParamValue(index, value)
+}
+
+// ParamName returns the name of plugin or mixer parameter.
+func (m *Mixer) ParamName(index int) string {
+	i, ok := m.mixerParam(index)
+	if !ok {
+		return m.plugin.ParamName(index)
+	}
+	switch i {
+	case MixParam:
+		return "Mix"
+	case InputTrimParam:
+		return "In Trim"
+	case OutputTrimParam:
+		return "Out Trim"
+	default:
+		return "Phase"
+	}
+}
+
+// ParamValueName returns the value label of plugin or mixer parameter.
+func (m *Mixer) ParamValueName(index int) string {
+	i, ok := m.mixerParam(index)
+	if !ok {
+		return m.plugin.ParamValueName(index)
+	}
+	value := float64(m.param(i))
+	switch i {
+	case MixParam:
+		return strconv.FormatFloat(value*100, 'f', 0, 64)
+	case InputTrimParam, OutputTrimParam:
+		return strconv.FormatFloat(trimDecibels(value), 'f', 1, 64)
+	default:
+		if value >= 0.5 {
+			return "On"
+		}
+		return "Off"
+	}
+}
+
+// ParamUnitName returns the unit label of plugin or mixer parameter.
+func (m *Mixer) ParamUnitName(index int) string {
+	i, ok := m.mixerParam(index)
+	if !ok {
+		return m.plugin.ParamUnitName(index)
+	}
+	switch i {
+	case MixParam:
+		return "%"
+	case InputTrimParam, OutputTrimParam:
+		return "dB"
+	default:
+		return ""
+	}
+}
+
+// InitialDelay returns the plugin latency.
+func (m *Mixer) InitialDelay() int {
+	return m.plugin.InitialDelay()
+}
+
+// ProcessDouble trims the input, processes it with plugin and mixes the
+// output with the delayed input. Gain changes are ramped over the buffer.
+func (m *Mixer) ProcessDouble(in, out DoubleBuffer) {
+	frames := in.Frames
+	m.in = growDoubleBuffer(m.in, len(in.data), frames)
+	if len(m.dry.scratch) < frames {
+		m.dry.scratch = make([]float64, frames)
+	}
+	m.dry.setDelay(len(out.data), m.plugin.InitialDelay())
+	if m.inputs != len(in.data) || len(m.dryInputs) != len(out.data) {
+		identity, _ := IdentityChannels(len(in.data), len(in.data), len(out.data))
+		m.dryInputs, m.inputs = identity.dryInputs(len(out.data)), len(in.data)
+	}
+
+	from, to := m.gains, m.targetGains()
+	step := 1 / float64(frames)
+	input := m.in
+	input.Frames = frames
+	for c := range in.data {
+		src, dst := in.Channel(c)[:frames], input.Channel(c)[:frames]
+		for i := range dst {
+			dst[i] = src[i] * ramp(from.input, to.input, float64(i+1)*step)
+		}
+	}
+	m.plugin.processZeroed(input, out)
+
+	for c := range out.data {
+		var src []float64
+		if i := m.dryInputs[c]; i >= 0 {
+			src = in.Channel(i)[:frames]
+		}
+		dry := m.dry.process(c, src, frames)
+		row := out.Channel(c)[:frames]
+		for i := range row {
+			t := float64(i+1) * step
+			row[i] = (row[i]*ramp(from.wet, to.wet, t) + dry[i]*ramp(from.dry, to.dry, t)) *
+				ramp(from.output, to.output, t)
+		}
+	}
+	m.dry.advance(frames)
+	m.gains = to
+}
+
+// Free releases the trimmed input buffer.
+func (m *Mixer) Free() {
+	m.in.Free()
+	m.in = DoubleBuffer{}
+}
+
+// mixerParam returns the mixer parameter offset for provided index.
+func (m *Mixer) mixerParam(index int) (int, bool) {
+	i := index - m.plugin.NumParams()
+	return i, i >= 0 && i < numMixerParams
+}
+
+func (m *Mixer) param(i int) float32 {
+	return math.Float32frombits(atomic.LoadUint32(&m.params[i]))
+}
+
+func (m *Mixer) setParam(i int, value float32) {
+	if value < 0 {
+		value = 0
+	} else if value > 1 {
+		value = 1
+	}
+	atomic.StoreUint32(&m.params[i], math.Float32bits(value))
+}
+
+// targetGains converts current parameter values into gains.
+func (m *Mixer) targetGains() mixerGains {
+	mix := float64(m.param(MixParam))
+	wet := mix
+	if m.param(PhaseInvertParam) >= 0.5 {
+		wet = -wet
+	}
+	return mixerGains{
+		input:  decibelsGain(trimDecibels(float64(m.param(InputTrimParam)))),
+		wet:    wet,
+		dry:    1 - mix,
+		output: decibelsGain(trimDecibels(float64(m.param(OutputTrimParam)))),
+	}
+}
+
+// trimDecibels maps normalized trim value to dB.
+func trimDecibels(value float64) float64 {
+	return (2*value - 1) * MaxTrim
+}
+
+func decibelsGain(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// ramp returns the linear interpolation between two values.
+func ramp(from, to, t float64) float64 {
+	return from + (to-from)*t
+}
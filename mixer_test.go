@@ -0,0 +1,97 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+func TestMixer(t *testing.T) {
+	path := skipIfNoPlugin(t)
+	v, err := vst2.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	const (
+		channels   = 2
+		bufferSize = 16
+		latency    = 4
+	)
+
+	p := v.Plugin(vst2.NoopHostCallback())
+	defer p.Close()
+	p.Start()
+	p.SetBufferSize(bufferSize)
+	p.Resume()
+	m := p.Mixer()
+	defer m.Free()
+
+	mix := p.NumParams() + vst2.MixParam
+	assertEqual(t, "num params", m.NumParams(), p.NumParams()+4)
+	assertEqual(t, "mix name", m.ParamName(mix), "Mix")
+	assertEqual(t, "mix value", m.ParamValueName(mix), "100")
+	assertEqual(t, "mix unit", m.ParamUnitName(mix), "%")
+	assertEqual(t, "trim value", m.ParamValueName(p.NumParams()+vst2.OutputTrimParam), "0.0")
+	assertEqual(t, "plugin param", m.ParamName(0), p.ParamName(0))
+
+	in := vst2.NewDoubleBuffer(channels, bufferSize)
+	defer in.Free()
+	out := vst2.NewDoubleBuffer(channels, bufferSize)
+	defer out.Free()
+	block := 0
+	// process returns the first channel of the next ramp block.
+	process := func() []float64 {
+		for c := 0; c < channels; c++ {
+			row := in.Channel(c)
+			for i := range row {
+				row[i] = float64(block*bufferSize + i)
+			}
+		}
+		block++
+		m.ProcessDouble(in, out)
+		return append([]float64(nil), out.Channel(0)...)
+	}
+	assertSamples := func(name string, result []float64, fn func(i int) float64) {
+		t.Helper()
+		for i, v := range result {
+			if expected := fn((block-1)*bufferSize + i); math.Abs(v-expected) > 1e-9 {
+				t.Fatalf("%s: sample %d expected %v got %v", name, i, expected, v)
+			}
+		}
+	}
+	delayed := func(i int) float64 {
+		if i < latency {
+			return 0
+		}
+		return float64(i - latency)
+	}
+
+	assertSamples("wet", process(), func(i int) float64 { return float64(i) })
+
+	// demo plugin doesn't delay the signal, only dry path is delayed.
+	vst2.SetInitialDelay(p, latency)
+	m.SetParamValue(mix, 0)
+	// gain changes are ramped over the first block.
+	process()
+	assertSamples("dry", process(), func(i int) float64 { return float64(i - latency) })
+
+	// x10 plugin gain.
+	m.SetParamValue(0, 1)
+	m.SetParamValue(mix, 0.5)
+	process()
+	assertSamples("mixed", process(), func(i int) float64 { return 5*float64(i) + 0.5*delayed(i) })
+
+	m.SetParamValue(mix, 1)
+	m.SetParamValue(p.NumParams()+vst2.PhaseInvertParam, 1)
+	m.SetParamValue(p.NumParams()+vst2.OutputTrimParam, 1)
+	assertEqual(t, "phase value", m.ParamValueName(p.NumParams()+vst2.PhaseInvertParam), "On")
+	process()
+	gain := math.Pow(10, vst2.MaxTrim/20.0)
+	assertSamples("inverted", process(), func(i int) float64 { return -10 * float64(i) * gain })
+}
@@ -0,0 +1,279 @@
+package vst2
+
+import (
+	"fmt"
+	"unsafe"
+
+	"pipelined.dev/signal"
+)
+
+type (
+	// OfflineTask describes a single offline processing task. The layout
+	// matches the VstOfflineTask structure. Tasks are allocated by host
+	// and must stay valid while plugin processes them.
+	OfflineTask struct {
+		// ProcessName is set by plugin.
+		ProcessName ascii96
+		// ReadPosition is the position of the first frame to read,
+		// set by plugin.
+		ReadPosition float64
+		// WritePosition is the position of the first frame to write,
+		// set by plugin.
+		WritePosition float64
+		// ReadCount is the number of frames to read, set by plugin
+		// and updated by host with the number of read frames.
+		ReadCount int32
+		// WriteCount is the number of frames to write, set by plugin
+		// and updated by host with the number of written frames.
+		WriteCount int32
+		// SizeInputBuffer is the size of input buffer in frames.
+		SizeInputBuffer int32
+		// SizeOutputBuffer is the size of output buffer in frames.
+		SizeOutputBuffer int32
+		// Input and output buffers hold a pointer per channel or a
+		// single pointer to interleaved samples if
+		// OfflineInterleavedAudio flag is set.
+		inputBuffer  unsafe.Pointer
+		outputBuffer unsafe.Pointer
+		// PositionToProcessFrom is the first frame of the processed
+		// region.
+		PositionToProcessFrom float64
+		// NumFramesToProcess is the length of the processed region.
+		NumFramesToProcess float64
+		// MaxFramesToWrite limits the number of written frames.
+		MaxFramesToWrite float64
+		// extraBuffer holds markers for OfflineMarker option.
+		extraBuffer unsafe.Pointer
+		// Value and Index are option-specific values.
+		Value int32
+		Index int32
+		// NumFramesInSourceFile is the length of source file.
+		NumFramesInSourceFile  float64
+		SourceSampleRate       float64
+		DestinationSampleRate  float64
+		NumSourceChannels      int32
+		NumDestinationChannels int32
+		// SourceFormat and DestinationFormat are not used.
+		SourceFormat      int32
+		DestinationFormat int32
+		// OutputText is the error message or any other text returned
+		// by plugin.
+		OutputText ascii512
+		// Progress is in range [0, 1].
+		Progress     float64
+		ProgressMode int32
+		ProgressText ascii100
+		Flags        OfflineTaskFlag
+		// ReturnValue is set by plugin.
+		ReturnValue int32
+		// hostOwned holds the index of the file plus one.
+		hostOwned uintptr
+		plugOwned uintptr
+		_         [1024]byte // reserved not used.
+	}
+
+	// OfflineTaskFlag values.
+	OfflineTaskFlag int32
+
+	// OfflineOption is the kind of data read or written by offline
+	// plugin.
+	OfflineOption int32
+
+	// AudioFile describes the audio file processed by offline plugin. The
+	// layout matches the VstAudioFile structure.
+	AudioFile struct {
+		Flags AudioFileFlag
+		// hostOwned holds the index of the file plus one.
+		hostOwned uintptr
+		plugOwned uintptr
+		Name      ascii100
+		UniqueID  int32
+		// SampleRate in Herz.
+		SampleRate  float64
+		NumChannels int32
+		NumFrames   float64
+		// Format is not used.
+		Format               int32
+		EditCursorPosition   float64
+		SelectionStart       float64
+		SelectionSize        float64
+		SelectedChannelsMask int32
+		NumMarkers           int32
+		TimeRulerUnit        int32
+		TimeRulerOffset      float64
+		Tempo                float64
+		TimeSigNumerator     int32
+		TimeSigDenominator   int32
+		TicksPerBlackNote    int32
+		SMPTEFrameRate
+		_ [64]byte // reserved not used.
+	}
+
+	// AudioFileFlag values.
+	AudioFileFlag int32
+
+	// AudioFileMarker is a marker of the audio file. The layout matches
+	// the VstAudioFileMarker structure.
+	AudioFileMarker struct {
+		Position float64
+		Name     ascii32
+		Type     int32
+		ID       int32
+		_        int32 // reserved not used.
+	}
+
+	// OfflineAudio provides samples of the audio file processed by
+	// offline plugin. Audio is accessed with random positions.
+	OfflineAudio interface {
+		Channels() int
+		Frames() int
+		SampleRate() signal.Frequency
+		// ReadAt copies frames starting from provided position into
+		// dst, one slice per channel. Returns number of read frames.
+		ReadAt(dst [][]float64, position int) (int, error)
+		// WriteAt copies src, one slice per channel, into the audio
+		// starting from provided position. Audio grows if needed.
+		WriteAt(src [][]float64, position int) (int, error)
+	}
+
+	// MemoryAudio is OfflineAudio that keeps samples in memory.
+	MemoryAudio struct {
+		Rate signal.Frequency
+		// Data holds samples per channel.
+		Data [][]float64
+	}
+)
+
+const (
+	// OfflineInvalidParameter is set by plugin if parameters are
+	// invalid.
+	OfflineInvalidParameter OfflineTaskFlag = 1 << 0
+	// OfflineNewFile is set by host if the task produces a new file.
+	OfflineNewFile OfflineTaskFlag = 1 << 1
+	// OfflinePluginError is set by plugin if task failed.
+	OfflinePluginError OfflineTaskFlag = 1 << 10
+	// OfflineInterleavedAudio is set by plugin if buffers hold
+	// interleaved samples.
+	OfflineInterleavedAudio OfflineTaskFlag = 1 << 11
+	// OfflineTempOutputFile is set by plugin if output is temporary.
+	OfflineTempOutputFile OfflineTaskFlag = 1 << 12
+	// OfflineFloatOutputFile is set by plugin if output file must use
+	// float samples.
+	OfflineFloatOutputFile OfflineTaskFlag = 1 << 13
+	// OfflineRandomWrite is set by plugin if it writes in random order.
+	OfflineRandomWrite OfflineTaskFlag = 1 << 14
+	// OfflineStretch is set by plugin if output length differs from
+	// input.
+	OfflineStretch OfflineTaskFlag = 1 << 15
+	// OfflineNoThread is set by plugin if it must run in the caller
+	// thread.
+	OfflineNoThread OfflineTaskFlag = 1 << 16
+)
+
+const (
+	// OfflineAudioOption reads or writes audio samples.
+	OfflineAudioOption OfflineOption = iota
+	// OfflinePeaksOption reads or writes peaks.
+	OfflinePeaksOption
+	// OfflineParameterOption reads or writes parameters.
+	OfflineParameterOption
+	// OfflineMarkerOption reads or writes markers.
+	OfflineMarkerOption
+	// OfflineCursorOption reads or moves the edit cursor.
+	OfflineCursorOption
+	// OfflineSelectionOption reads or changes the selection.
+	OfflineSelectionOption
+	// OfflineQueryFilesOption requests files from host.
+	OfflineQueryFilesOption
+)
+
+const (
+	// AudioFileReadOnly means that file can't be modified.
+	AudioFileReadOnly AudioFileFlag = 1 << 0
+	// AudioFileNoRateConversion means that file can't change the sample
+	// rate.
+	AudioFileNoRateConversion AudioFileFlag = 1 << 1
+	// AudioFileNoChannelChange means that file can't change the number
+	// of channels.
+	AudioFileNoChannelChange AudioFileFlag = 1 << 2
+	// AudioFileCanProcessSelection means that plugin can process the
+	// selection.
+	AudioFileCanProcessSelection AudioFileFlag = 1 << 10
+	// AudioFileNoCrossfade means that host shouldn't crossfade the
+	// processed selection.
+	AudioFileNoCrossfade AudioFileFlag = 1 << 11
+	// AudioFileWantRead is set by plugin to read the file.
+	AudioFileWantRead AudioFileFlag = 1 << 12
+	// AudioFileWantWrite is set by plugin to write the file.
+	AudioFileWantWrite AudioFileFlag = 1 << 13
+	// AudioFileWantWriteMarker is set by plugin to write markers.
+	AudioFileWantWriteMarker AudioFileFlag = 1 << 14
+	// AudioFileWantMoveCursor is set by plugin to move the edit cursor.
+	AudioFileWantMoveCursor AudioFileFlag = 1 << 15
+	// AudioFileWantSelect is set by plugin to change the selection.
+	AudioFileWantSelect AudioFileFlag = 1 << 16
+)
+
+// SetName sets the name of audio file.
+func (f *AudioFile) SetName(name string) {
+	f.Name = ascii100{}
+	copyASCII(f.Name[:], name)
+}
+
+// SetName sets the name of the marker.
+func (m *AudioFileMarker) SetName(name string) {
+	m.Name = ascii32{}
+	copyASCII(m.Name[:], name)
+}
+
+// Channels returns number of channels.
+func (a *MemoryAudio) Channels() int {
+	return len(a.Data)
+}
+
+// Frames returns number of frames.
+func (a *MemoryAudio) Frames() int {
+	if len(a.Data) == 0 {
+		return 0
+	}
+	return len(a.Data[0])
+}
+
+// SampleRate returns sample rate of the audio.
+func (a *MemoryAudio) SampleRate() signal.Frequency {
+	return a.Rate
+}
+
+// ReadAt copies frames starting from provided position into dst.
+func (a *MemoryAudio) ReadAt(dst [][]float64, position int) (int, error) {
+	if len(dst) != len(a.Data) {
+		return 0, fmt.Errorf("read %d channels from %d channels audio", len(dst), len(a.Data))
+	}
+	if position < 0 || position > a.Frames() {
+		return 0, fmt.Errorf("read position %d is out of range", position)
+	}
+	var read int
+	for c := range dst {
+		read = copy(dst[c], a.Data[c][position:])
+	}
+	return read, nil
+}
+
+// WriteAt copies src into the audio starting from provided position. The
+// gap between the end of audio and the position is filled with silence.
+func (a *MemoryAudio) WriteAt(src [][]float64, position int) (int, error) {
+	if len(src) != len(a.Data) {
+		return 0, fmt.Errorf("write %d channels into %d channels audio", len(src), len(a.Data))
+	}
+	if position < 0 {
+		return 0, fmt.Errorf("write position %d is out of range", position)
+	}
+	var written int
+	for c := range src {
+		if end := position + len(src[c]); end > len(a.Data[c]) {
+			a.Data[c] = append(a.Data[c], make([]float64, end-len(a.Data[c]))...)
+		}
+		written = copy(a.Data[c][position:], src[c])
+	}
+	return written, nil
+}
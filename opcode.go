@@ -21,6 +21,15 @@ type (
 
 	// 64 bytes ascii string.
 	ascii64 [64]byte
+
+	// 96 bytes ascii string.
+	ascii96 [96]byte
+
+	// 100 bytes ascii string.
+	ascii100 [100]byte
+
+	// 512 bytes ascii string.
+	ascii512 [512]byte
 )
 
 func (s ascii8) String() string {
@@ -39,6 +48,18 @@ func (s ascii64) String() string {
 	return trimNull(string(s[:]))
 }
 
+func (s ascii96) String() string {
+	return trimNull(string(s[:]))
+}
+
+func (s ascii100) String() string {
+	return trimNull(string(s[:]))
+}
+
+func (s ascii512) String() string {
+	return trimNull(string(s[:]))
+}
+
 // PluginOpcode is sent by host in dispatch call to plugin.
 // It reflects APluginOpcodes and APluginXOpcodes opcodes values.
 type PluginOpcode uint32
@@ -0,0 +1,324 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"fmt"
+	"math"
+
+	"pipelined.dev/signal"
+)
+
+// OversamplingQuality selects the length and the stopband attenuation of
+// the oversampling filters. Higher quality has a longer latency.
+type OversamplingQuality int
+
+const (
+	// OversamplingMedium uses 32 taps per phase.
+	OversamplingMedium OversamplingQuality = iota
+	// OversamplingLow uses 16 taps per phase.
+	OversamplingLow
+	// OversamplingHigh uses 64 taps per phase.
+	OversamplingHigh
+)
+
+type (
+	// Oversampler runs the plugin at the multiple of the sample rate.
+	// The input is upsampled with polyphase filter, processed by plugin
+	// and the output is downsampled back. Host GetSampleRate callback
+	// must report Oversampler.SampleRate.
+	Oversampler struct {
+		plugin  *Plugin
+		factor  int
+		quality OversamplingQuality
+		// sampleRate is the rate of the signal outside the plugin.
+		sampleRate signal.Frequency
+		// filter coefficients shared by all channels.
+		filter *polyphaseFilter
+		up     []interpolator
+		down   []decimator
+		// in and out are plugin buffers at the oversampled rate.
+		in  DoubleBuffer
+		out DoubleBuffer
+	}
+
+	// polyphaseFilter is linear-phase lowpass filter split into phases.
+	// The filter has factor*taps+1 coefficients, so its delay is taps/2
+	// frames at the base rate.
+	polyphaseFilter struct {
+		factor int
+		taps   int
+		// phases hold reversed coefficients of each phase scaled by
+		// factor, used by interpolator.
+		phases [][]float64
+		// reversed holds all reversed coefficients, used by decimator.
+		reversed []float64
+	}
+
+	// interpolator upsamples single channel.
+	interpolator struct {
+		*polyphaseFilter
+		history ring
+	}
+
+	// decimator downsamples single channel.
+	decimator struct {
+		*polyphaseFilter
+		history ring
+		phase   int
+	}
+
+	// ring keeps the last samples in chronological order. Every sample
+	// is written twice, so the window is always continuous.
+	ring struct {
+		data     []float64
+		position int
+	}
+)
+
+// Oversampler returns wrapper that processes the plugin at factor times
+// higher sample rate. Supported factors are 2, 4 and 8.
+func (p *Plugin) Oversampler(factor int, quality OversamplingQuality) (*Oversampler, error) {
+	switch factor {
+	case 2, 4, 8:
+	default:
+		return nil, fmt.Errorf("unsupported oversampling factor: %d", factor)
+	}
+	filter := newPolyphaseFilter(factor, quality)
+	o := Oversampler{
+		plugin:  p,
+		factor:  factor,
+		quality: quality,
+		filter:  filter,
+		up:      make([]interpolator, p.NumInputs()),
+		down:    make([]decimator, p.NumOutputs()),
+	}
+	for i := range o.up {
+		o.up[i] = interpolator{polyphaseFilter: filter, history: newRing(filter.taps + 1)}
+	}
+	for i := range o.down {
+		o.down[i] = decimator{polyphaseFilter: filter, history: newRing(len(filter.reversed))}
+	}
+	return &o, nil
+}
+
+// Factor returns the oversampling factor.
+func (o *Oversampler) Factor() int {
+	return o.factor
+}
+
+// Plugin returns the wrapped plugin.
+func (o *Oversampler) Plugin() *Plugin {
+	return o.plugin
+}
+
+// SetSampleRate sets the base sample rate. Plugin receives the oversampled
+// rate.
+func (o *Oversampler) SetSampleRate(sampleRate signal.Frequency) {
+	o.sampleRate = sampleRate
+	o.plugin.SetSampleRate(o.SampleRate())
+}
+
+// SampleRate returns the oversampled rate that plugin runs at.
+func (o *Oversampler) SampleRate() signal.Frequency {
+	return o.sampleRate * signal.Frequency(o.factor)
+}
+
+// SetBufferSize allocates the oversampled buffers for the maximum number
+// of base rate frames per process call.
+func (o *Oversampler) SetBufferSize(bufferSize int) {
+	o.in.Free()
+	o.out.Free()
+	o.in = NewDoubleBuffer(o.plugin.NumInputs(), bufferSize*o.factor)
+	o.out = NewDoubleBuffer(o.plugin.NumOutputs(), bufferSize*o.factor)
+	o.plugin.SetBufferSize(bufferSize * o.factor)
+}
+
+// Latency returns the delay of the oversampling filters in base rate
+// frames.
+func (o *Oversampler) Latency() int {
+	return o.filter.taps
+}
+
+// InitialDelay returns the plugin delay converted to the base rate with
+// the latency of oversampling filters.
+func (o *Oversampler) InitialDelay() int {
+	return (o.plugin.InitialDelay()+o.factor/2)/o.factor + o.Latency()
+}
+
+// GetTailSize returns the plugin tail size converted to the base rate. The
+// special values 0 and 1 are preserved.
+func (o *Oversampler) GetTailSize() int {
+	tail := o.plugin.GetTailSize()
+	if tail <= 1 {
+		return tail
+	}
+	return (tail+o.factor-1)/o.factor + o.Latency()
+}
+
+// ProcessDouble upsamples the input, processes it with the plugin and
+// downsamples the output. Buffer frames must not exceed the size set with
+// SetBufferSize.
+func (o *Oversampler) ProcessDouble(in, out DoubleBuffer) {
+	frames := in.Frames
+	input, output := o.in, o.out
+	input.Frames, output.Frames = frames*o.factor, frames*o.factor
+	for c := range o.up {
+		var src []float64
+		if c < len(in.data) {
+			src = in.Channel(c)[:frames]
+		}
+		o.up[c].process(src, input.Channel(c)[:input.Frames], frames)
+	}
+	o.plugin.processZeroed(input, output)
+	for c := range o.down {
+		if c >= len(out.data) {
+			break
+		}
+		o.down[c].process(output.Channel(c)[:output.Frames], out.Channel(c)[:frames])
+	}
+}
+
+// Reset clears the filters state.
+func (o *Oversampler) Reset() {
+	for i := range o.up {
+		o.up[i].history.reset()
+	}
+	for i := range o.down {
+		o.down[i].history.reset()
+		o.down[i].phase = 0
+	}
+}
+
+// Free releases the oversampled buffers.
+func (o *Oversampler) Free() {
+	o.in.Free()
+	o.out.Free()
+	o.in, o.out = DoubleBuffer{}, DoubleBuffer{}
+}
+
+// newPolyphaseFilter designs Kaiser-windowed sinc lowpass filter. Cutoff
+// is placed below the base rate Nyquist frequency, so the transition band
+// ends there.
+func newPolyphaseFilter(factor int, quality OversamplingQuality) *polyphaseFilter {
+	var (
+		taps   int
+		beta   float64
+		cutoff float64
+	)
+	switch quality {
+	case OversamplingLow:
+		taps, beta, cutoff = 16, 6, 0.8
+	case OversamplingHigh:
+		taps, beta, cutoff = 64, 10, 0.95
+	default:
+		taps, beta, cutoff = 32, 8, 0.9
+	}
+	// cutoff relative to the oversampled rate.
+	cutoff = cutoff * 0.5 / float64(factor)
+	length := factor*taps + 1
+	center := float64(length-1) / 2
+	coefs := make([]float64, length)
+	var sum float64
+	for i := range coefs {
+		x := float64(i) - center
+		sinc := 2 * cutoff
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		r := x / center
+		coefs[i] = sinc * besselI0(beta*math.Sqrt(1-r*r)) / besselI0(beta)
+		sum += coefs[i]
+	}
+	for i := range coefs {
+		coefs[i] /= sum
+	}
+
+	// pad coefficients to the multiple of factor.
+	padded := make([]float64, factor*(taps+1))
+	copy(padded, coefs)
+	f := polyphaseFilter{
+		factor:   factor,
+		taps:     taps,
+		phases:   make([][]float64, factor),
+		reversed: make([]float64, len(padded)),
+	}
+	for i, v := range padded {
+		f.reversed[len(padded)-1-i] = v
+	}
+	for p := range f.phases {
+		phase := make([]float64, taps+1)
+		for k := range phase {
+			phase[taps-k] = padded[p+k*factor] * float64(factor)
+		}
+		f.phases[p] = phase
+	}
+	return &f
+}
+
+// process upsamples frames of input into output. Nil input is treated as
+// silence.
+func (f *interpolator) process(in, out []float64, frames int) {
+	for i := 0; i < frames; i++ {
+		var v float64
+		if in != nil {
+			v = in[i]
+		}
+		window := f.history.push(v)
+		for p, phase := range f.phases {
+			out[i*f.factor+p] = dot(window, phase)
+		}
+	}
+}
+
+// process downsamples input into output. Output sample is produced for
+// every first sample of the factor frames.
+func (f *decimator) process(in, out []float64) {
+	n := 0
+	for _, v := range in {
+		window := f.history.push(v)
+		if f.phase == 0 {
+			out[n] = dot(window, f.reversed)
+			n++
+		}
+		f.phase = (f.phase + 1) % f.factor
+	}
+}
+
+func newRing(size int) ring {
+	return ring{data: make([]float64, 2*size)}
+}
+
+// push writes the sample and returns the window of the last samples with
+// the newest sample at the end.
+func (r *ring) push(v float64) []float64 {
+	size := len(r.data) / 2
+	r.data[r.position] = v
+	r.data[r.position+size] = v
+	r.position = (r.position + 1) % size
+	return r.data[r.position : r.position+size]
+}
+
+func (r *ring) reset() {
+	zero(r.data)
+	r.position = 0
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
@@ -0,0 +1,49 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPolyphaseFilter(t *testing.T) {
+	t.Parallel()
+	testRoundTrip := func(factor int, quality OversamplingQuality) func(*testing.T) {
+		return func(t *testing.T) {
+			t.Parallel()
+			const frames = 1024
+			filter := newPolyphaseFilter(factor, quality)
+			up := interpolator{polyphaseFilter: filter, history: newRing(filter.taps + 1)}
+			down := decimator{polyphaseFilter: filter, history: newRing(len(filter.reversed))}
+
+			in := make([]float64, frames)
+			for i := range in {
+				in[i] = math.Sin(2 * math.Pi * 0.01 * float64(i))
+			}
+			upsampled := make([]float64, frames*factor)
+			up.process(in, upsampled, frames)
+			out := make([]float64, frames)
+			down.process(upsampled, out)
+
+			// compare after the filters are filled.
+			latency := filter.taps
+			for i := 2 * latency; i < frames; i++ {
+				if d := math.Abs(out[i] - in[i-latency]); d > 1e-3 {
+					t.Fatalf("sample %d: expected %v got %v", i, in[i-latency], out[i])
+				}
+			}
+			// upsampled signal is interpolated between input samples.
+			for i := latency * factor; i < frames*factor; i++ {
+				expected := math.Sin(2 * math.Pi * 0.01 * (float64(i)/float64(factor) - float64(latency)/2))
+				if d := math.Abs(upsampled[i] - expected); d > 1e-3 {
+					t.Fatalf("upsampled %d: expected %v got %v", i, expected, upsampled[i])
+				}
+			}
+		}
+	}
+	t.Run("2x low", testRoundTrip(2, OversamplingLow))
+	t.Run("4x medium", testRoundTrip(4, OversamplingMedium))
+	t.Run("8x high", testRoundTrip(8, OversamplingHigh))
+}
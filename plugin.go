@@ -10,7 +10,6 @@ package vst2
 import "C"
 
 import (
-	"sync"
 	"unsafe"
 
 	"pipelined.dev/signal"
@@ -19,13 +18,9 @@ import (
 var (
 	PluginAllocator PluginAllocatorFunc
 
-	// global state for callbacks.
-	plugins = struct {
-		sync.RWMutex
-		mapping map[uintptr]*Plugin
-	}{
-		mapping: map[uintptr]*Plugin{},
-	}
+	// instances of plugins. CPlugin keeps the handle of its instance
+	// in object field.
+	plugins handleTable
 )
 
 type (
@@ -229,7 +224,18 @@ func (h callbackHandler) host(cp *C.CPlugin) Host {
 }
 
 func getPlugin(cp *C.CPlugin) *Plugin {
-	plugins.RLock()
-	defer plugins.RUnlock()
-	return plugins.mapping[uintptr(unsafe.Pointer(cp))]
+	p, _ := plugins.lookup(int(C.getPluginHandle(cp))).(*Plugin)
+	return p
+}
+
+// registerPlugin adds instance to the table and stores its handle in
+// CPlugin.
+func registerPlugin(cp *C.CPlugin, p *Plugin) {
+	C.setPluginHandle(cp, C.uintptr_t(plugins.register(p)))
+}
+
+// unregisterPlugin removes instance from the table.
+func unregisterPlugin(cp *C.CPlugin) {
+	plugins.unregister(int(C.getPluginHandle(cp)))
+	C.setPluginHandle(cp, 0)
 }
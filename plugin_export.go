@@ -41,9 +41,7 @@ func newGoPlugin(cp *C.CPlugin, c C.HostCallback) {
 		cp.flags = cp.flags | C.int(PluginProgramChunks)
 	}
 	p.dispatchFunc = d.dispatchFunc(p)
-	plugins.Lock()
-	plugins.mapping[uintptr(unsafe.Pointer(cp))] = &p
-	plugins.Unlock()
+	registerPlugin(cp, &p)
 }
 
 // global dispatch, calls real plugin dispatch.
@@ -54,9 +52,7 @@ func dispatchPluginBridge(cp *C.CPlugin, opcode int32, index int32, value int64,
 	pluginOpcode := PluginOpcode(opcode)
 	ret := p.dispatchFunc(pluginOpcode, index, value, ptr, opt)
 	if pluginOpcode == plugClose {
-		plugins.RLock()
-		defer plugins.RUnlock()
-		delete(plugins.mapping, uintptr(unsafe.Pointer(cp)))
+		unregisterPlugin(cp)
 	}
 	return ret
 }
@@ -0,0 +1,186 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Pool processes independent plugins concurrently on a bounded
+	// number of workers. Every worker runs on a locked OS thread. Plugins
+	// created by the pool report the pool process level while they are
+	// processed by worker.
+	Pool struct {
+		level ProcessLevel
+		// queues hold batches of jobs assigned to the specific worker.
+		queues []chan []*PoolJob
+		// batches are reused to assign jobs of the block to workers.
+		batches [][]*PoolJob
+		// shared holds jobs that any worker can take.
+		shared chan *PoolJob
+		// block is the barrier of the current block.
+		block   sync.WaitGroup
+		workers sync.WaitGroup
+
+		mu sync.RWMutex
+		// processing flags of plugins created by pool.
+		processing map[*Plugin]*int32
+	}
+
+	// PoolJob is a single process call of the pool block. Every job of
+	// the block must have own plugin and buffers.
+	PoolJob struct {
+		Plugin *Plugin
+		In     DoubleBuffer
+		Out    DoubleBuffer
+		// Events are sent to the plugin before the process call.
+		Events []Event
+	}
+)
+
+// NewPool starts the pool with provided number of workers. Number of CPUs
+// is used if workers is not positive. Level is reported by plugins while
+// they are processed. For ProcessLevelOffline, jobs are statically
+// assigned to workers by their index in the block, so every plugin is
+// always processed on the same thread in the same order. Otherwise jobs
+// are taken by the first free worker.
+func NewPool(workers int, level ProcessLevel) *Pool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	p := Pool{
+		level:      level,
+		queues:     make([]chan []*PoolJob, workers),
+		batches:    make([][]*PoolJob, workers),
+		shared:     make(chan *PoolJob),
+		processing: map[*Plugin]*int32{},
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan []*PoolJob)
+		p.workers.Add(1)
+		go p.work(p.queues[i])
+	}
+	return &p
+}
+
+// Plugin creates the plugin that is processed by the pool. GetProcessLevel
+// callback is wrapped to report the pool level while plugin is processed
+// by worker. Otherwise the wrapped callback result or ProcessLevelUser is
+// reported. Plugin is removed from the pool when it's closed.
+func (p *Pool) Plugin(v *VST, h Host) *Plugin {
+	processing := new(int32)
+	h.GetProcessLevel = p.processLevel(processing, h.GetProcessLevel)
+	plugin := v.Plugin(h.Callback())
+	if plugin == nil {
+		return nil
+	}
+	p.mu.Lock()
+	p.processing[plugin] = processing
+	p.mu.Unlock()
+	plugin.onClose = func() {
+		p.mu.Lock()
+		delete(p.processing, plugin)
+		p.mu.Unlock()
+	}
+	return plugin
+}
+
+// Process executes the block of jobs and returns when all of them are
+// done. Blocks must not be processed concurrently.
+func (p *Pool) Process(jobs []PoolJob) {
+	p.block.Add(len(jobs))
+	if p.level != ProcessLevelOffline {
+		for i := range jobs {
+			p.shared <- &jobs[i]
+		}
+		p.block.Wait()
+		return
+	}
+	// every worker receives all its jobs at once, so a busy worker
+	// doesn't hold back the others.
+	for w := range p.batches {
+		p.batches[w] = p.batches[w][:0]
+	}
+	for i := range jobs {
+		w := i % len(p.batches)
+		p.batches[w] = append(p.batches[w], &jobs[i])
+	}
+	for w, batch := range p.batches {
+		if len(batch) > 0 {
+			p.queues[w] <- batch
+		}
+	}
+	p.block.Wait()
+}
+
+// Close stops the workers. Plugins created by the pool are not closed.
+func (p *Pool) Close() {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.workers.Wait()
+}
+
+// work processes jobs from own queue and shared queue until own queue is
+// closed.
+func (p *Pool) work(queue chan []*PoolJob) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer p.workers.Done()
+	// events buffer is reused by all jobs of the worker.
+	var events EventsBuffer
+	defer events.Free()
+	for {
+		select {
+		case batch, ok := <-queue:
+			if !ok {
+				return
+			}
+			for _, job := range batch {
+				p.run(job, &events)
+				p.block.Done()
+			}
+		case job := <-p.shared:
+			p.run(job, &events)
+			p.block.Done()
+		}
+	}
+}
+
+// run executes a single job.
+func (p *Pool) run(job *PoolJob, events *EventsBuffer) {
+	p.mu.RLock()
+	processing := p.processing[job.Plugin]
+	p.mu.RUnlock()
+	if processing != nil {
+		atomic.StoreInt32(processing, 1)
+		defer atomic.StoreInt32(processing, 0)
+	}
+	if len(job.Events) > 0 {
+		events.reserve(len(job.Events))
+		events.Reset()
+		for _, e := range job.Events {
+			events.Append(e)
+		}
+		job.Plugin.SendEvents(events.Events())
+	}
+	job.Plugin.ProcessDouble(job.In, job.Out)
+}
+
+// processLevel returns GetProcessLevel callback that reports the pool
+// level while plugin is processed.
+func (p *Pool) processLevel(processing *int32, fn HostGetProcessLevelFunc) HostGetProcessLevelFunc {
+	return func() ProcessLevel {
+		if atomic.LoadInt32(processing) == 1 {
+			return p.level
+		}
+		if fn != nil {
+			return fn()
+		}
+		return ProcessLevelUser
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import "testing"
+
+func TestPoolProcessLevel(t *testing.T) {
+	t.Parallel()
+	pool := NewPool(1, ProcessLevelOffline)
+	defer pool.Close()
+
+	var processing int32
+	level := pool.processLevel(&processing, nil)
+	assertEqual(t, "idle", level(), ProcessLevelUser)
+	processing = 1
+	assertEqual(t, "processing", level(), ProcessLevelOffline)
+
+	processing = 0
+	level = pool.processLevel(&processing, func() ProcessLevel {
+		return ProcessLevelPrefetch
+	})
+	assertEqual(t, "wrapped", level(), ProcessLevelPrefetch)
+}
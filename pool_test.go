@@ -0,0 +1,84 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2_test
+
+import (
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+func TestPool(t *testing.T) {
+	path := skipIfNoPlugin(t)
+	v, err := vst2.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	const (
+		plugins    = 8
+		channels   = 2
+		bufferSize = 64
+		blocks     = 4
+	)
+
+	process := func(t *testing.T, level vst2.ProcessLevel) [][]float64 {
+		pool := vst2.NewPool(3, level)
+		defer pool.Close()
+		jobs := make([]vst2.PoolJob, plugins)
+		for i := range jobs {
+			p := pool.Plugin(v, vst2.Host{})
+			defer p.Close()
+			p.Start()
+			p.SetBufferSize(bufferSize)
+			if i%2 == 1 {
+				// x10 gain on every other plugin.
+				p.SetParamValue(0, 1)
+			}
+			p.Resume()
+			jobs[i] = vst2.PoolJob{
+				Plugin: p,
+				In:     vst2.NewDoubleBuffer(channels, bufferSize),
+				Out:    vst2.NewDoubleBuffer(channels, bufferSize),
+			}
+			defer jobs[i].In.Free()
+			defer jobs[i].Out.Free()
+		}
+		result := make([][]float64, plugins)
+		for b := 0; b < blocks; b++ {
+			for i := range jobs {
+				for c := 0; c < channels; c++ {
+					row := jobs[i].In.Channel(c)
+					for j := range row {
+						row[j] = float64(b*bufferSize + j + i)
+					}
+				}
+			}
+			pool.Process(jobs)
+			for i := range jobs {
+				result[i] = append(result[i], jobs[i].Out.Channel(0)...)
+			}
+		}
+		return result
+	}
+
+	offline := process(t, vst2.ProcessLevelOffline)
+	for i := range offline {
+		gain := 1.0
+		if i%2 == 1 {
+			gain = 10
+		}
+		for j, v := range offline[i] {
+			assertEqual(t, "sample", v, float64(j+i)*gain)
+		}
+	}
+	assertEqual(t, "deterministic", process(t, vst2.ProcessLevelOffline), offline)
+	assertEqual(t, "realtime", process(t, vst2.ProcessLevelRealtime), offline)
+
+	pool := vst2.NewPool(1, vst2.ProcessLevelOffline)
+	defer pool.Close()
+	pool.Plugin(v, vst2.Host{}).Close()
+	assertEqual(t, "closed plugins removed", vst2.PoolPlugins(pool), 0)
+}
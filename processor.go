@@ -5,6 +5,9 @@ package vst2
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
 
 	"pipelined.dev/pipe"
 	"pipelined.dev/pipe/mutable"
@@ -14,11 +17,89 @@ import (
 type (
 	// Processor is pipe component that wraps.
 	Processor struct {
+		// CompensateLatency enables the latency compensation. The first
+		// InitialDelay samples of the plugin output are discarded, so
+		// the output lines up with the input. The line source must be
+		// wrapped with Processor.Source to flush the delayed signal
+		// after the input ends.
+		CompensateLatency bool
+		// Tail enables rendering of the plugin tail after the input
+		// ends. If plugin reports the tail size, it's rendered
+		// completely. Otherwise the rendering stops when the output
+		// stays below TailThreshold for TailHold frames. The line
+		// source must be wrapped with Processor.Source to feed the
+		// silence into the plugin.
+		Tail bool
+		// TailThreshold is the absolute sample value below which the
+		// tail is considered silent. DefaultTailThreshold is used if
+		// zero.
+		TailThreshold float64
+		// TailHold is the number of continuous silent frames that ends
+		// the tail. DefaultTailHold seconds are used if zero.
+		TailHold int
+		// MaxTail limits the tail length in frames. DefaultMaxTail
+		// seconds are used if zero.
+		MaxTail int
+		// Channels maps the line channels to the plugin inputs and the
+		// plugin outputs to the line channels. IdentityChannels is used
+		// if nil.
+		Channels ChannelMapFunc
+		// ZeroFillInputs allows plugin inputs that are not connected to
+		// the line. Such inputs receive silence.
+		ZeroFillInputs bool
+		// MaxBlockSize limits the number of frames passed to the plugin
+		// in a single process call. Larger blocks are split. The buffer
+		// size of the pipe is used if zero.
+		MaxBlockSize int
+		// Precision is the policy of the processing precision
+		// negotiation. PreferDouble is used by default.
+		Precision PrecisionPolicy
+		// Sidechain feeds the signal of another line into the plugin
+		// input bus. Line channels are not routed into that bus.
+		Sidechain *Sidechain
+		// BypassFade is the length of crossfade in frames when the
+		// host-side bypass is toggled. DefaultBypassFade seconds are
+		// used if zero.
+		BypassFade int
+		// Oversampling runs the plugin at factor times higher sample
+		// rate. Supported factors are 2, 4 and 8. Oversampling is
+		// disabled if zero or one. The filter latency is added to the
+		// plugin latency.
+		Oversampling int
+		// OversamplingQuality selects the oversampling filters.
+		OversamplingQuality OversamplingQuality
+		// Sanitizer replaces NaN, Inf and denormal samples of the
+		// plugin output. Incident positions are counted in plugin
+		// frames from the start of the line.
+		Sanitizer *Sanitizer
+		// Capture receives events sent by the plugin. Processor updates
+		// the capture position before every block, so events are
+		// positioned in the line frames. Host reports that it can
+		// receive events if capture is set. Capture must be set before
+		// the processor is allocated.
+		Capture *MIDICapture
+
 		bufferSize int
 		channels   int
+		channelMap ChannelMap
 		sampleRate signal.Frequency
 		plugin     *Plugin
 		progressFn ProgressProcessedFunc
+		events     *EventScheduler
+		// padding is the number of silent frames the source must
+		// append after the input ends.
+		padding int64
+		// tailOpen is set while the length of the tail is unknown.
+		tailOpen int32
+		// inputLength is the number of input frames, set by the
+		// source when the input ends. Negative until then.
+		inputLength int64
+		// ioChanged is set when plugin signals HostIOChanged.
+		ioChanged int32
+		// bypass is set when processor is bypassed.
+		bypass int32
+		// oversampler is set when oversampling is enabled.
+		oversampler *Oversampler
 	}
 
 	// ProcessorInitFunc applies configuration on plugin before starting it
@@ -28,111 +109,584 @@ type (
 	// HostProgressProcessed is executed by processor after every process
 	// call.
 	ProgressProcessedFunc func(int)
+
+	// delayLine delays channels by a fixed number of frames.
+	delayLine struct {
+		delay    int
+		position int
+		buffers  [][]float64
+		scratch  []float64
+	}
+
+	// engine processes pipe signal buffers with the plugin. The signal
+	// is always kept in double buffers, plugin converts it if float
+	// precision is negotiated.
+	engine struct {
+		*Processor
+		in, out  DoubleBuffer
+		position int64
+		// mixed is a scratch buffer for line channels that mix
+		// multiple plugin outputs.
+		mixed []float64
+		// sidechain holds the plugin inputs fed by sidechain.
+		sidechain []int
+		// pluginBypass is set if plugin supports bypass itself.
+		pluginBypass bool
+		bypassed     bool
+		// dryInputs holds the plugin input of dry signal for every
+		// plugin output.
+		dryInputs []int
+		// dry is the plugin input delayed by the plugin latency, it's
+		// used by host-side bypass.
+		dry delayLine
+		// wet is the gain of the host-side bypass crossfade: 1 when
+		// processed and 0 when bypassed.
+		wet float64
+		// latency is the plugin latency that's currently compensated.
+		latency int
+		// skip is the number of output frames that must be discarded.
+		skip int
+		// emitted is the number of output frames.
+		emitted int64
+		// tail detects the end of tail with unknown length, it's
+		// used if threshold is set.
+		tail     tailDetector
+		tailDone bool
+	}
+)
+
+const (
+	// DefaultTailThreshold is -80 dBFS.
+	DefaultTailThreshold = 1e-4
+	// DefaultMaxTail is the tail length limit in seconds.
+	DefaultMaxTail = 30
+	// DefaultBypassFade is the bypass crossfade length in seconds.
+	DefaultBypassFade = 0.01
 )
 
 // Processor represents vst2 sound processor. Processor always overrides
 // GetBufferSize and GetSampleRate callbacks, because this vaules are
-// injected when processor is allocated by pipe.
+// injected when processor is allocated by pipe. Buffer size is limited by
+// MaxBlockSize. Both report oversampled values if oversampling is
+// enabled. IOChanged callback is wrapped to track the plugin latency,
+// ProcessEvents callback is wrapped to feed the Capture and CanDo callback
+// reports start and stop process support.
 func (v *VST) Processor(h Host, progressFn ProgressProcessedFunc) *Processor {
-	processor := Processor{}
+	processor := &Processor{
+		progressFn: progressFn,
+		events:     NewEventScheduler(0),
+	}
 	h.GetBufferSize = func() int {
-		return processor.bufferSize
+		return processor.maxBlockSize() * processor.oversampling()
 	}
 	h.GetSampleRate = func() signal.Frequency {
-		return processor.sampleRate
+		return processor.sampleRate * signal.Frequency(processor.oversampling())
 	}
-	plugin := v.Plugin(h.Callback())
-	return &Processor{
-		plugin:     plugin,
-		progressFn: progressFn,
+	canDo := supportCanDo(h.CanDo, HostCanStartStopProcess)
+	h.CanDo = func(s HostCanDoString) CanDoResponse {
+		return processor.Capture.canDo(canDo)(s)
+	}
+	processEvents := h.ProcessEvents
+	h.ProcessEvents = func(events *EventsPtr) {
+		if processor.Capture != nil {
+			processor.Capture.capture(events)
+		}
+		if processEvents != nil {
+			processEvents(events)
+		}
+	}
+	ioChanged := h.IOChanged
+	h.IOChanged = func() bool {
+		atomic.StoreInt32(&processor.ioChanged, 1)
+		if ioChanged != nil {
+			return ioChanged()
+		}
+		return true
+	}
+	processor.plugin = v.Plugin(h.Callback())
+	return processor
+}
+
+// SendEvents queues events that will be delivered to the plugin. Every
+// event is addressed by the absolute sample position in the processed
+// line. Right before the block that contains the position is processed,
+// events are passed to the plugin with DeltaFrames relative to the block
+// start. Events with positions that were already processed are delivered
+// at the start of the next block. It's safe to call this method while
+// the line is running. SysEx dumps must stay valid until the event is
+// delivered.
+func (p *Processor) SendEvents(events ...TimedEvent) {
+	p.events.Schedule(events...)
+}
+
+// SetBypass switches the processor bypass. The plugin bypass is used if
+// plugin supports it. Otherwise plugin output is crossfaded with the input,
+// delayed by the plugin latency. It's safe to call this method while the
+// line is running.
+func (p *Processor) SetBypass(bypass bool) {
+	var value int32
+	if bypass {
+		value = 1
+	}
+	atomic.StoreInt32(&p.bypass, value)
+}
+
+// Source wraps the line source. After the wrapped source is done, silence
+// is appended to flush the signal delayed by the plugin and to render the
+// plugin tail.
+func (p *Processor) Source(fn pipe.SourceAllocatorFunc) pipe.SourceAllocatorFunc {
+	return func(mctx mutable.Context, bufferSize int) (pipe.Source, error) {
+		source, err := fn(mctx, bufferSize)
+		if err != nil {
+			return source, err
+		}
+		var (
+			sourceFn = source.SourceFunc
+			ended    bool
+			length   int64
+			padded   int64
+		)
+		source.SourceFunc = func(out signal.Floating) (int, error) {
+			if !ended {
+				read, err := sourceFn(out)
+				if err != io.EOF {
+					length += int64(read)
+					return read, err
+				}
+				ended = true
+				atomic.StoreInt64(&p.inputLength, length)
+			}
+			left := atomic.LoadInt64(&p.padding) - padded
+			if atomic.LoadInt32(&p.tailOpen) == 1 {
+				left += int64(p.maxTail())
+			}
+			if left <= 0 {
+				return 0, io.EOF
+			}
+			frames := out.Length()
+			if int64(frames) > left {
+				frames = int(left)
+			}
+			for i := 0; i < frames*out.Channels(); i++ {
+				out.SetSample(i, 0)
+			}
+			padded += int64(frames)
+			return frames, nil
+		}
+		return source, nil
 	}
 }
 
 // Allocator returns pipe processor allocator that can be plugged into line.
 func (p *Processor) Allocator(init ProcessorInitFunc) pipe.ProcessorAllocatorFunc {
+	return p.allocator(init, false)
+}
+
+// allocator returns pipe processor allocator. If stems is set, the output
+// part of the channel map is replaced and every plugin output produces the
+// line channel with the same index.
+func (p *Processor) allocator(init ProcessorInitFunc, stems bool) pipe.ProcessorAllocatorFunc {
 	return func(mctx mutable.Context, bufferSize int, props pipe.SignalProperties) (pipe.Processor, error) {
 		p.bufferSize = bufferSize
 		p.channels = props.Channels
 		p.sampleRate = props.SampleRate
+		p.oversampler = nil
+		if p.Oversampling > 1 {
+			o, err := p.plugin.Oversampler(p.Oversampling, p.OversamplingQuality)
+			if err != nil {
+				return pipe.Processor{}, err
+			}
+			p.oversampler = o
+		}
 		p.plugin.Start()
-		p.plugin.SetSampleRate(props.SampleRate)
-		p.plugin.SetBufferSize(bufferSize)
+		if p.oversampler != nil {
+			p.oversampler.SetSampleRate(props.SampleRate)
+			p.oversampler.SetBufferSize(p.maxBlockSize())
+		} else {
+			p.plugin.SetSampleRate(props.SampleRate)
+			p.plugin.SetBufferSize(p.maxBlockSize())
+		}
 		if init != nil {
 			init(p.plugin)
 		}
-		processFn, flushFn := processorFns(p.plugin, p.channels, p.bufferSize, p.progressFn)
+		p.plugin.SetPrecision(p.Precision)
+		p.plugin.SetSanitizer(p.Sanitizer)
+		channelsFn := p.Channels
+		if channelsFn == nil {
+			channelsFn = IdentityChannels
+		}
+		var err error
+		if p.channelMap, err = channelsFn(p.channels, p.plugin.NumInputs(), p.plugin.NumOutputs()); err != nil {
+			return pipe.Processor{}, err
+		}
+		if stems {
+			identity, _ := IdentityChannels(p.channels, p.plugin.NumInputs(), p.plugin.NumOutputs())
+			p.channelMap.Outputs = identity.Outputs
+		}
+		var sidechain []int
+		if p.Sidechain != nil {
+			busFn := p.Sidechain.Bus
+			if busFn == nil {
+				busFn = SidechainBus
+			}
+			bus, err := busFn(p.plugin.InputBuses())
+			if err != nil {
+				return pipe.Processor{}, fmt.Errorf("sidechain: %w", err)
+			}
+			sidechain = bus.Pins
+			// line channels are not routed into sidechain.
+			inputs := append([]int(nil), p.channelMap.Inputs...)
+			for _, pin := range sidechain {
+				if pin < len(inputs) {
+					inputs[pin] = -1
+				}
+			}
+			p.channelMap.Inputs = inputs
+			p.Sidechain.open()
+		}
+		if err := p.channelMap.validate(p.channels, p.plugin.NumInputs(), p.plugin.NumOutputs(), p.ZeroFillInputs, sidechain...); err != nil {
+			return pipe.Processor{}, fmt.Errorf("invalid channel map: %w", err)
+		}
+		e := p.engine()
+		e.sidechain = sidechain
 		return pipe.Processor{
 			SignalProperties: pipe.SignalProperties{
-				Channels:   p.channels,
+				Channels:   len(p.channelMap.Outputs),
 				SampleRate: p.sampleRate,
 			},
 			StartFunc: func(context.Context) error {
 				p.plugin.Resume()
+				p.plugin.StartProcess()
+				// plugins initialize the delay on resume.
+				e.updateLatency()
+				e.startTail()
 				return nil
 			},
-			ProcessFunc: processFn,
-			FlushFunc:   flushFn,
+			ProcessFunc: e.process,
+			FlushFunc:   e.flush,
 		}, nil
 	}
 }
 
-func processorFns(p *Plugin, channels, bufferSize int, progressFn ProgressProcessedFunc) (pipe.ProcessFunc, pipe.FlushFunc) {
-	if p.CanProcessFloat64() {
-		return doubleFns(p, channels, bufferSize, progressFn)
+func (p *Processor) engine() *engine {
+	e := engine{
+		Processor: p,
+		in:        NewDoubleBuffer(p.plugin.NumInputs(), p.maxBlockSize()),
+		out:       NewDoubleBuffer(p.plugin.NumOutputs(), p.maxBlockSize()),
+		mixed:     make([]float64, p.maxBlockSize()),
+		wet:       1,
+	}
+	e.pluginBypass = p.plugin.CanDo(PluginCanBypass) == YesCanDo
+	e.dryInputs = p.channelMap.dryInputs(p.plugin.NumOutputs())
+	e.dry.scratch = make([]float64, p.maxBlockSize())
+	if atomic.LoadInt32(&p.bypass) == 1 {
+		// start bypassed without fade.
+		e.wet = 0
+	}
+	atomic.StoreInt32(&p.ioChanged, 0)
+	atomic.StoreInt64(&p.padding, 0)
+	atomic.StoreInt32(&p.tailOpen, 0)
+	atomic.StoreInt64(&p.inputLength, -1)
+	return &e
+}
+
+// process splits the input into blocks that fit the plugin buffers. Output
+// must have enough capacity to fit the input.
+func (e *engine) process(in, out signal.Floating) (int, error) {
+	var emitted int
+	for offset := 0; offset < in.Length() && !e.tailDone; {
+		frames := min(in.Length()-offset, e.in.Frames)
+		emitted += e.processBlock(in, out, offset, emitted, frames)
+		offset += frames
+	}
+	if e.progressFn != nil {
+		e.progressFn(in.Length())
+	}
+	return emitted, nil
+}
+
+// processBlock processes frames of input starting at provided offset and
+// writes the result into output at provided position. Returns the number
+// of frames written to the output.
+func (e *engine) processBlock(in, out signal.Floating, offset, position, frames int) int {
+	if atomic.CompareAndSwapInt32(&e.ioChanged, 1, 0) {
+		e.updateLatency()
+	}
+	e.route(in, offset, frames)
+	if e.Capture != nil {
+		e.Capture.setBlock(e.position, e.oversampling())
+	}
+	if events := e.events.Next(e.position, frames); events != nil {
+		// oversampled plugin processes factor times more frames.
+		if e.oversampler != nil {
+			scaleDeltaFrames(events, int32(e.oversampler.Factor()))
+		}
+		e.plugin.SendEvents(events)
+	}
+	// buffer views with exact number of frames.
+	input, output := e.in, e.out
+	input.Frames, output.Frames = frames, frames
+	if e.oversampler != nil {
+		e.oversampler.ProcessDouble(input, output)
+	} else {
+		e.plugin.processZeroed(input, output)
+	}
+	e.applyBypass(frames)
+	e.position += int64(frames)
+
+	// discard the delayed frames.
+	skip := min(e.skip, frames)
+	e.skip -= skip
+	emit := frames - skip
+	if e.tail.threshold > 0 {
+		emit = e.detectTailEnd(skip, emit)
+	}
+	e.mix(out, position, skip, emit)
+	e.emitted += int64(emit)
+	return emit
+}
+
+// route copies line channels into the plugin inputs.
+func (e *engine) route(in signal.Floating, offset, frames int) {
+	for i, c := range e.channelMap.Inputs {
+		if c < 0 {
+			continue
+		}
+		readChannel(in, c, offset, e.in.Channel(i)[:frames])
+	}
+	if len(e.sidechain) > 0 {
+		e.Sidechain.read(e.in, e.sidechain, frames)
 	}
-	return floatFns(p, channels, bufferSize, progressFn)
 }
 
-func doubleFns(p *Plugin, channels, bufferSize int, progressFn ProgressProcessedFunc) (pipe.ProcessFunc, pipe.FlushFunc) {
-	doubleIn := NewDoubleBuffer(channels, bufferSize)
-	doubleOut := NewDoubleBuffer(channels, bufferSize)
-	processFn := func(in, out signal.Floating) (int, error) {
-		doubleIn.Write(in)
-		p.ProcessDouble(doubleIn, doubleOut)
-		doubleOut.Read(out)
-		return in.Length(), nil
+// mix copies plugin outputs starting from provided offset into the line
+// channels at provided position.
+func (e *engine) mix(out signal.Floating, position, offset, frames int) {
+	for c, outputs := range e.channelMap.Outputs {
+		switch len(outputs) {
+		case 0:
+			mixed := e.mixed[:frames]
+			zero(mixed)
+			writeChannel(out, c, position, mixed)
+		case 1:
+			writeChannel(out, c, position, e.out.Channel(outputs[0])[offset:offset+frames])
+		default:
+			mixed := e.mixed[:frames]
+			copy(mixed, e.out.Channel(outputs[0])[offset:])
+			for _, o := range outputs[1:] {
+				row := e.out.Channel(o)[offset:]
+				for i := range mixed {
+					mixed[i] += row[i]
+				}
+			}
+			gain := 1 / float64(len(outputs))
+			for i := range mixed {
+				mixed[i] *= gain
+			}
+			writeChannel(out, c, position, mixed)
+		}
 	}
-	if progressFn != nil {
-		processFn = func(in, out signal.Floating) (int, error) {
-			doubleIn.Write(in)
-			p.ProcessDouble(doubleIn, doubleOut)
-			doubleOut.Read(out)
-			progressFn(in.Length())
-			return in.Length(), nil
+}
+
+// applyBypass switches the plugin bypass or crossfades the plugin output
+// with the delayed input.
+func (e *engine) applyBypass(frames int) {
+	bypass := atomic.LoadInt32(&e.bypass) == 1
+	if e.pluginBypass {
+		if bypass != e.bypassed {
+			e.plugin.setBypass(bypass)
+			e.bypassed = bypass
 		}
+		return
+	}
+	target, step := 1.0, 1/float64(e.bypassFade())
+	if bypass {
+		target, step = 0, -step
 	}
-	return processFn,
-		func(context.Context) error {
-			doubleIn.Free()
-			doubleOut.Free()
-			p.Suspend()
-			return nil
+	wet := e.wet
+	for c := range e.out.data {
+		var in []float64
+		if i := e.dryInputs[c]; i >= 0 {
+			in = e.in.Channel(i)[:frames]
 		}
+		dry := e.dry.process(c, in, frames)
+		if e.wet == target && target == 1 {
+			continue
+		}
+		out := e.out.Channel(c)[:frames]
+		wet = e.wet
+		for i := range out {
+			if wet != target {
+				wet += step
+				if wet < 0 || wet > 1 {
+					wet = target
+				}
+			}
+			out[i] = out[i]*wet + dry[i]*(1-wet)
+		}
+	}
+	e.dry.advance(frames)
+	e.wet = wet
+}
+
+// startTail reads the plugin tail size and determines how the tail is
+// rendered.
+func (e *engine) startTail() {
+	if !e.Tail {
+		return
+	}
+	tail := e.plugin.GetTailSize()
+	if e.oversampler != nil {
+		tail = e.oversampler.GetTailSize()
+	}
+	switch {
+	case tail == 1:
+		// plugin has no tail.
+	case tail > 1:
+		atomic.AddInt64(&e.padding, int64(min(tail, e.maxTail())))
+	default:
+		e.tail = newTailDetector(e.TailThreshold, e.TailHold, e.sampleRate)
+		atomic.StoreInt32(&e.tailOpen, 1)
+	}
+}
+
+// detectTailEnd checks the part of the output that follows the end of
+// input. If the tail is done, the number of frames up to its end is
+// returned.
+func (e *engine) detectTailEnd(offset, frames int) int {
+	length := atomic.LoadInt64(&e.inputLength)
+	if length < 0 || e.emitted+int64(frames) <= length {
+		return frames
+	}
+	start := 0
+	if e.emitted < length {
+		start = int(length - e.emitted)
+	}
+	tail, done := e.tail.detect(e.out, offset+start, frames-start)
+	if !done {
+		return frames
+	}
+	e.tailDone = true
+	atomic.StoreInt32(&e.tailOpen, 0)
+	return start + tail
+}
+
+// updateLatency reads the plugin latency and updates the number of frames
+// that must be discarded.
+func (e *engine) updateLatency() {
+	latency := e.plugin.InitialDelay()
+	if e.oversampler != nil {
+		latency = e.oversampler.InitialDelay()
+	}
+	e.dry.setDelay(len(e.out.data), latency)
+	if !e.CompensateLatency {
+		return
+	}
+	delta := latency - e.latency
+	if delta < -e.skip {
+		// frames were already discarded, the output can't be
+		// realigned.
+		delta = -e.skip
+	}
+	e.skip += delta
+	atomic.AddInt64(&e.padding, int64(delta))
+	e.latency = latency
 }
 
-func floatFns(p *Plugin, channels, bufferSize int, progressFn ProgressProcessedFunc) (pipe.ProcessFunc, pipe.FlushFunc) {
-	floatIn := NewFloatBuffer(channels, bufferSize)
-	floatOut := NewFloatBuffer(channels, bufferSize)
-	processFn := func(in, out signal.Floating) (int, error) {
-		floatIn.Write(in)
-		p.ProcessFloat(floatIn, floatOut)
-		floatOut.Read(out)
-		return in.Length(), nil
+// maxBlockSize returns the maximum number of frames per process call.
+func (p *Processor) maxBlockSize() int {
+	if p.MaxBlockSize > 0 {
+		return p.MaxBlockSize
 	}
-	if progressFn != nil {
-		processFn = func(in, out signal.Floating) (int, error) {
-			floatIn.Write(in)
-			p.ProcessFloat(floatIn, floatOut)
-			floatOut.Read(out)
-			progressFn(in.Length())
-			return in.Length(), nil
+	return p.bufferSize
+}
+
+// oversampling returns the oversampling factor.
+func (p *Processor) oversampling() int {
+	if p.Oversampling > 1 {
+		return p.Oversampling
+	}
+	return 1
+}
+
+// bypassFade returns the length of bypass crossfade in frames.
+func (p *Processor) bypassFade() int {
+	if p.BypassFade > 0 {
+		return p.BypassFade
+	}
+	if fade := int(DefaultBypassFade * p.sampleRate); fade > 0 {
+		return fade
+	}
+	return 1
+}
+
+// maxTail returns the limit of the tail length in frames.
+func (p *Processor) maxTail() int {
+	if p.MaxTail > 0 {
+		return p.MaxTail
+	}
+	return int(DefaultMaxTail * p.sampleRate)
+}
+
+func (e *engine) flush(context.Context) error {
+	if e.Sidechain != nil {
+		e.Sidechain.close()
+	}
+	e.in.Free()
+	e.out.Free()
+	if e.oversampler != nil {
+		e.oversampler.Free()
+	}
+	e.events.Free()
+	e.plugin.StopProcess()
+	e.plugin.Suspend()
+	return nil
+}
+
+// setDelay resets the delay line if the number of channels or the delay
+// changes.
+func (d *delayLine) setDelay(channels, delay int) {
+	if d.delay == delay && len(d.buffers) == channels {
+		return
+	}
+	d.delay, d.position = delay, 0
+	d.buffers = make([][]float64, channels)
+	for c := range d.buffers {
+		d.buffers[c] = make([]float64, delay)
+	}
+}
+
+// process pushes frames of the channel into the delay line and returns
+// delayed frames. Nil input is silent. The returned slice is valid until
+// the next call.
+func (d *delayLine) process(channel int, in []float64, frames int) []float64 {
+	out := d.scratch[:frames]
+	if d.delay == 0 {
+		if in == nil {
+			zero(out)
+		} else {
+			copy(out, in)
 		}
+		return out
 	}
-	return processFn,
-		func(context.Context) error {
-			floatIn.Free()
-			floatOut.Free()
-			p.Suspend()
-			return nil
+	buf, pos := d.buffers[channel], d.position
+	for i := range out {
+		out[i] = buf[pos]
+		buf[pos] = 0
+		if in != nil {
+			buf[pos] = in[i]
+		}
+		if pos++; pos == d.delay {
+			pos = 0
 		}
+	}
+	return out
+}
+
+// advance moves the delay line position after all channels are
+// processed.
+func (d *delayLine) advance(frames int) {
+	if d.delay > 0 {
+		d.position = (d.position + frames) % d.delay
+	}
 }
@@ -5,6 +5,8 @@ package vst2_test
 
 import (
 	"context"
+	"io"
+	"math"
 	"testing"
 
 	"github.com/cwbudde/vst2"
@@ -135,4 +137,534 @@ func TestProcessor(t *testing.T) {
 			t.Errorf("expected sample rate %v, got %v", sampleRate, p.SampleRate)
 		}
 	})
+	t.Run("events", func(t *testing.T) {
+		t.Parallel()
+		// demo plugin sends received events back to the host.
+		var received []vst2.MIDIEvent
+		processor := v.Processor(vst2.Host{
+			ProcessEvents: func(events *vst2.EventsPtr) {
+				for i := 0; i < events.NumEvents(); i++ {
+					received = append(received, *events.Event(i).(*vst2.MIDIEvent))
+				}
+			},
+		}, nil)
+		processor.SendEvents(
+			vst2.TimedEvent{Position: 10, Event: &vst2.MIDIEvent{Data: [3]byte{0x90, 0x3C, 0x40}}},
+			vst2.TimedEvent{Position: bufferSize + 5, Event: &vst2.MIDIEvent{Data: [3]byte{0x80, 0x3C, 0x40}}},
+		)
+		p, err := processor.Allocator(nil)(mutable.Context{}, bufferSize, pipe.SignalProperties{
+			Channels:   channels,
+			SampleRate: sampleRate,
+		})
+		if err != nil {
+			t.Fatalf("allocator failed: %v", err)
+		}
+		if err := p.StartFunc(context.Background()); err != nil {
+			t.Fatalf("StartFunc failed: %v", err)
+		}
+		in := signal.Allocator{Channels: channels, Length: bufferSize, Capacity: bufferSize}.Float64()
+		out := signal.Allocator{Channels: channels, Length: bufferSize, Capacity: bufferSize}.Float64()
+		for i := 0; i < 2; i++ {
+			if _, err := p.ProcessFunc(in, out); err != nil {
+				t.Fatalf("ProcessFunc failed: %v", err)
+			}
+		}
+		if err := p.FlushFunc(context.Background()); err != nil {
+			t.Fatalf("FlushFunc failed: %v", err)
+		}
+		assertEqual(t, "events", len(received), 2)
+		assertEqual(t, "note on delta", received[0].DeltaFrames, int32(10))
+		assertEqual(t, "note on data", received[0].Data, [3]byte{0x90, 0x3C, 0x40})
+		assertEqual(t, "note off delta", received[1].DeltaFrames, int32(5))
+		assertEqual(t, "note off data", received[1].Data, [3]byte{0x80, 0x3C, 0x40})
+	})
+	t.Run("latency compensation", func(t *testing.T) {
+		t.Parallel()
+		const (
+			latency = 10
+			length  = 150
+		)
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.CompensateLatency = true
+		result := runLine(t, bufferSize,
+			processor.Source(rampSource(channels, sampleRate, length)),
+			processor.Allocator(func(p *vst2.Plugin) {
+				vst2.SetInitialDelay(p, latency)
+			}),
+		)
+		assertEqual(t, "output length", len(result[0]), length)
+		for c := range result {
+			for i := 0; i < length-latency; i++ {
+				assertEqual(t, "sample", result[c][i], float64(i+latency))
+			}
+			for i := length - latency; i < length; i++ {
+				assertEqual(t, "padding", result[c][i], 0.0)
+			}
+		}
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		t.Parallel()
+		const (
+			length = 150
+			hold   = 50
+		)
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.Tail = true
+		processor.TailHold = hold
+		processor.MaxTail = 1000
+		result := runLine(t, bufferSize,
+			processor.Source(rampSource(channels, sampleRate, length)),
+			processor.Allocator(nil),
+		)
+		// the gain plugin has no tail, so rendering stops after hold
+		// frames of silence.
+		assertEqual(t, "output length", len(result[0]), length+hold)
+		for i := 0; i < length+hold; i++ {
+			expected := 0.0
+			if i < length {
+				expected = float64(i)
+			}
+			assertEqual(t, "sample", result[0][i], expected)
+		}
+	})
+
+	t.Run("mono to stereo", func(t *testing.T) {
+		t.Parallel()
+		const length = 100
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.Channels = vst2.MonoToStereo
+		result := runLine(t, bufferSize,
+			rampSource(1, sampleRate, length),
+			processor.Allocator(nil),
+		)
+		assertEqual(t, "output channels", len(result), 2)
+		for c := range result {
+			for i := 0; i < length; i++ {
+				assertEqual(t, "sample", result[c][i], float64(i))
+			}
+		}
+	})
+
+	t.Run("stereo to mono", func(t *testing.T) {
+		t.Parallel()
+		const length = 100
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.Channels = vst2.StereoToMono
+		result := runLine(t, bufferSize,
+			rampSource(channels, sampleRate, length),
+			processor.Allocator(nil),
+		)
+		assertEqual(t, "output channels", len(result), 1)
+		for i := 0; i < length; i++ {
+			assertEqual(t, "sample", result[0][i], float64(i))
+		}
+	})
+
+	t.Run("unconnected input", func(t *testing.T) {
+		t.Parallel()
+		processor := v.Processor(vst2.Host{}, nil)
+		_, err := processor.Allocator(nil)(mutable.Context{}, bufferSize, pipe.SignalProperties{
+			Channels:   1,
+			SampleRate: sampleRate,
+		})
+		if err == nil {
+			t.Fatal("expected error for unconnected plugin input")
+		}
+
+		processor = v.Processor(vst2.Host{}, nil)
+		processor.ZeroFillInputs = true
+		result := runLine(t, bufferSize,
+			rampSource(1, sampleRate, 10),
+			processor.Allocator(nil),
+		)
+		assertEqual(t, "output channels", len(result), 2)
+		assertEqual(t, "zero filled", result[1], make([]float64, 10))
+	})
+
+	t.Run("variable io", func(t *testing.T) {
+		t.Parallel()
+		processor := v.VarIOProcessor(vst2.Host{})
+		_, err := processor.Allocator(nil)(mutable.Context{}, bufferSize, pipe.SignalProperties{
+			Channels:   1,
+			SampleRate: sampleRate,
+		})
+		if err == nil {
+			t.Fatal("expected error for channels mismatch")
+		}
+
+		processor = v.VarIOProcessor(vst2.Host{})
+		processor.SampleRate = 2 * sampleRate
+		r, err := pipe.Line{
+			Context:    mutable.Mutable(),
+			Source:     processor.Source(rampSource(channels, sampleRate, 100)),
+			Processors: pipe.Processors(processor.Allocator(nil)),
+			Sink: func(mctx mutable.Context, bufferSize int, props pipe.SignalProperties) (pipe.Sink, error) {
+				assertEqual(t, "output sample rate", props.SampleRate, signal.Frequency(2*sampleRate))
+				return pipe.Sink{SinkFunc: func(signal.Floating) error { return nil }}, nil
+			},
+		}.Runner(bufferSize, nil)
+		if err != nil {
+			t.Fatalf("failed to bind line: %v", err)
+		}
+		// demo plugin doesn't support variable io.
+		if err := r.Run(context.Background()); err == nil {
+			t.Fatal("expected error for plugin without variable io")
+		}
+	})
+
+	t.Run("oversampling", func(t *testing.T) {
+		t.Parallel()
+		const length = 300
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.Oversampling = 3
+		_, err := processor.Allocator(nil)(mutable.Context{}, bufferSize, pipe.SignalProperties{
+			Channels:   channels,
+			SampleRate: sampleRate,
+		})
+		if err == nil {
+			t.Fatal("expected error for unsupported factor")
+		}
+
+		processor = v.Processor(vst2.Host{}, nil)
+		processor.Oversampling = 2
+		processor.CompensateLatency = true
+		result := runLine(t, bufferSize,
+			processor.Source(rampSource(channels, sampleRate, length)),
+			processor.Allocator(nil),
+		)
+		assertEqual(t, "length", len(result[0]), length)
+		// filters ring at the start and the end of the ramp.
+		for i := 32; i < length-32; i++ {
+			if d := math.Abs(result[0][i] - float64(i)); d > 1e-2 {
+				t.Fatalf("sample %d: expected %v got %v", i, float64(i), result[0][i])
+			}
+		}
+
+		// demo plugin sends received events back to the host.
+		var deltas []int32
+		processor = v.Processor(vst2.Host{
+			ProcessEvents: func(events *vst2.EventsPtr) {
+				for i := 0; i < events.NumEvents(); i++ {
+					deltas = append(deltas, events.Event(i).(*vst2.MIDIEvent).DeltaFrames)
+				}
+			},
+		}, nil)
+		processor.Oversampling = 4
+		processor.SendEvents(
+			vst2.TimedEvent{Position: 10, Event: vst2.NewMIDIEvent(0, vst2.NoteOn{Key: 60, Velocity: 100})},
+			vst2.TimedEvent{Position: bufferSize + 5, Event: vst2.NewMIDIEvent(0, vst2.NoteOff{Key: 60})},
+		)
+		runLine(t, bufferSize,
+			processor.Source(rampSource(channels, sampleRate, length)),
+			processor.Allocator(nil),
+		)
+		assertEqual(t, "oversampled deltas", deltas, []int32{40, 20})
+	})
+
+	t.Run("capture", func(t *testing.T) {
+		t.Parallel()
+		const length = 300
+		for _, factor := range []int{1, 4} {
+			processor := v.Processor(vst2.Host{}, nil)
+			processor.Oversampling = factor
+			processor.Capture = vst2.NewMIDICapture(0)
+			processor.SendEvents(
+				vst2.TimedEvent{Position: 10, Event: vst2.NewMIDIEvent(0, vst2.NoteOn{Key: 60, Velocity: 100})},
+				vst2.TimedEvent{Position: bufferSize + 5, Event: vst2.NewMIDIEvent(0, vst2.NoteOff{Key: 60})},
+			)
+			runLine(t, bufferSize,
+				processor.Source(rampSource(channels, sampleRate, length)),
+				processor.Allocator(nil),
+			)
+			// demo plugin sends received events back to the host.
+			var positions []int64
+			for len(processor.Capture.Events()) > 0 {
+				positions = append(positions, (<-processor.Capture.Events()).Position)
+			}
+			assertEqual(t, "captured positions", positions, []int64{10, bufferSize + 5})
+		}
+	})
+
+	t.Run("block splitting", func(t *testing.T) {
+		t.Parallel()
+		const length = 150
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.MaxBlockSize = 24
+		result := runLine(t, bufferSize,
+			rampSource(channels, sampleRate, length),
+			processor.Allocator(nil),
+		)
+		assertEqual(t, "host buffer size", vst2.HostBufferSize(processor), 24)
+		assertEqual(t, "output length", len(result[0]), length)
+		for i := 0; i < length; i++ {
+			assertEqual(t, "sample", result[0][i], float64(i))
+		}
+	})
+
+	t.Run("float precision", func(t *testing.T) {
+		t.Parallel()
+		const length = 100
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.Precision = vst2.ForceFloat
+		result := runLine(t, bufferSize,
+			rampSource(channels, sampleRate, length),
+			processor.Allocator(nil),
+		)
+		assertEqual(t, "output length", len(result[0]), length)
+		for i := 0; i < length; i++ {
+			assertEqual(t, "sample", result[1][i], float64(i))
+		}
+	})
+
+	t.Run("sidechain", func(t *testing.T) {
+		t.Parallel()
+		const (
+			length          = 200
+			sidechainLength = 100
+		)
+		processor := v.Processor(vst2.Host{}, nil)
+		// demo plugin has a single bus, so the main line is not routed.
+		processor.Sidechain = &vst2.Sidechain{Bus: vst2.StaticBus(0)}
+		var result [][]float64
+		p, err := pipe.New(bufferSize,
+			pipe.Line{
+				Source:     rampSource(channels, sampleRate, length),
+				Processors: pipe.Processors(processor.Allocator(nil)),
+				Sink:       collectSink(&result),
+			},
+			pipe.Line{
+				Source: rampSource(1, sampleRate, sidechainLength),
+				Sink:   processor.Sidechain.Sink(),
+			},
+		)
+		if err != nil {
+			t.Fatalf("failed to bind pipe: %v", err)
+		}
+		if err := pipe.Wait(p.Start(context.Background())); err != nil {
+			t.Fatalf("failed to run pipe: %v", err)
+		}
+		assertEqual(t, "output length", len(result[0]), length)
+		for c := range result {
+			for i := 0; i < length; i++ {
+				expected := 0.0
+				if i < sidechainLength {
+					expected = float64(i)
+				}
+				assertEqual(t, "sample", result[c][i], expected)
+			}
+		}
+	})
+
+	t.Run("stems", func(t *testing.T) {
+		t.Parallel()
+		const length = 100
+		processor := v.Processor(vst2.Host{}, nil)
+		// output part of the map is ignored by stems render.
+		processor.Channels = vst2.StereoToMono
+		results := map[string]*[][]float64{}
+		err := processor.RenderStems(context.Background(), bufferSize,
+			rampSource(channels, sampleRate, length),
+			func(name string, bus vst2.Bus) pipe.SinkAllocatorFunc {
+				var result [][]float64
+				results[name] = &result
+				return collectSink(&result)
+			},
+		)
+		if err != nil {
+			t.Fatalf("failed to render stems: %v", err)
+		}
+		assertEqual(t, "stems", len(results), 1)
+		result := *results["Output 1"]
+		assertEqual(t, "stem channels", len(result), channels)
+		for i := 0; i < length; i++ {
+			assertEqual(t, "sample", result[1][i], float64(i))
+		}
+	})
+
+	t.Run("bypass", func(t *testing.T) {
+		t.Parallel()
+		const (
+			length = 512
+			toggle = 128
+			fade   = 32
+		)
+		// +20 dB gain makes processed signal distinguishable.
+		gain := func(p *vst2.Plugin) {
+			p.SetParamValue(0, 1)
+		}
+
+		processor := v.Processor(vst2.Host{}, nil)
+		processor.SetBypass(true)
+		result := runLine(t, bufferSize,
+			rampSource(channels, sampleRate, length),
+			processor.Allocator(gain),
+		)
+		for i := 0; i < length; i++ {
+			assertEqual(t, "bypassed sample", result[0][i], float64(i))
+		}
+
+		processor = v.Processor(vst2.Host{}, nil)
+		processor.BypassFade = fade
+		source := rampSource(channels, sampleRate, length)
+		var position int
+		result = runLine(t, bufferSize,
+			func(mctx mutable.Context, bufferSize int) (pipe.Source, error) {
+				s, err := source(mctx, bufferSize)
+				fn := s.SourceFunc
+				s.SourceFunc = func(out signal.Floating) (int, error) {
+					if position >= toggle {
+						processor.SetBypass(true)
+					}
+					n, err := fn(out)
+					position += n
+					return n, err
+				}
+				return s, err
+			},
+			processor.Allocator(gain),
+		)
+		ratio := 10.0
+		for i := 1; i < length; i++ {
+			r := result[0][i] / float64(i)
+			switch {
+			case i < toggle:
+				assertEqual(t, "processed sample", r, 10.0)
+			case i >= toggle+fade:
+				assertEqual(t, "bypassed sample", r, 1.0)
+			case r > ratio:
+				t.Fatalf("crossfade is not monotonic at %d: %v > %v", i, r, ratio)
+			}
+			ratio = r
+		}
+
+		// mono line feeds the first input only, dry is duplicated to
+		// both outputs.
+		processor = v.Processor(vst2.Host{}, nil)
+		processor.Channels = vst2.StaticChannels(vst2.ChannelMap{
+			Inputs:  []int{0, -1},
+			Outputs: [][]int{{0}, {1}},
+		})
+		processor.ZeroFillInputs = true
+		processor.SetBypass(true)
+		result = runLine(t, bufferSize,
+			rampSource(1, sampleRate, length),
+			processor.Allocator(gain),
+		)
+		for i := 0; i < length; i++ {
+			assertEqual(t, "left bypassed sample", result[0][i], float64(i))
+			assertEqual(t, "right bypassed sample", result[1][i], float64(i))
+		}
+	})
+
+	t.Run("oversized and short blocks", func(t *testing.T) {
+		t.Parallel()
+		processor := v.Processor(vst2.Host{}, nil)
+		p, err := processor.Allocator(nil)(mutable.Context{}, bufferSize, pipe.SignalProperties{
+			Channels:   channels,
+			SampleRate: sampleRate,
+		})
+		if err != nil {
+			t.Fatalf("allocator failed: %v", err)
+		}
+		if err := p.StartFunc(context.Background()); err != nil {
+			t.Fatalf("StartFunc failed: %v", err)
+		}
+		process := func(length int, value float64) []float64 {
+			in := signal.Allocator{Channels: channels, Length: length, Capacity: length}.Float64()
+			out := signal.Allocator{Channels: channels, Length: length, Capacity: length}.Float64()
+			for i := 0; i < in.Len(); i++ {
+				in.SetSample(i, value)
+			}
+			processed, err := p.ProcessFunc(in, out)
+			if err != nil {
+				t.Fatalf("ProcessFunc failed: %v", err)
+			}
+			assertEqual(t, "processed", processed, length)
+			result := make([]float64, length)
+			for i := range result {
+				result[i] = out.Sample(out.BufferIndex(0, i))
+			}
+			return result
+		}
+		for i, s := range process(3*bufferSize+5, 1) {
+			if s != 1 {
+				t.Fatalf("oversized block sample %d: expected 1, got %v", i, s)
+			}
+		}
+		for i, s := range process(10, 2) {
+			if s != 2 {
+				t.Fatalf("short block sample %d: expected 2, got %v", i, s)
+			}
+		}
+		if err := p.FlushFunc(context.Background()); err != nil {
+			t.Fatalf("FlushFunc failed: %v", err)
+		}
+	})
+}
+
+// rampSource returns a source that generates sample indices as values.
+func rampSource(channels int, sampleRate signal.Frequency, length int) pipe.SourceAllocatorFunc {
+	return func(mctx mutable.Context, bufferSize int) (pipe.Source, error) {
+		var position int
+		return pipe.Source{
+			SignalProperties: pipe.SignalProperties{
+				Channels:   channels,
+				SampleRate: sampleRate,
+			},
+			SourceFunc: func(out signal.Floating) (int, error) {
+				if position == length {
+					return 0, io.EOF
+				}
+				read := out.Length()
+				if left := length - position; left < read {
+					read = left
+				}
+				for c := 0; c < channels; c++ {
+					for i := 0; i < read; i++ {
+						out.SetSample(out.BufferIndex(c, i), float64(position+i))
+					}
+				}
+				position += read
+				return read, nil
+			},
+		}, nil
+	}
+}
+
+// runLine executes the line with provided source and processor and
+// returns the processed signal.
+func runLine(t *testing.T, bufferSize int, source pipe.SourceAllocatorFunc, processors ...pipe.ProcessorAllocatorFunc) [][]float64 {
+	t.Helper()
+	var result [][]float64
+	r, err := pipe.Line{
+		Context:    mutable.Mutable(),
+		Source:     source,
+		Processors: processors,
+		Sink:       collectSink(&result),
+	}.Runner(bufferSize, nil)
+	if err != nil {
+		t.Fatalf("failed to bind line: %v", err)
+	}
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatalf("failed to run line: %v", err)
+	}
+	return result
+}
+
+// collectSink appends received signal to the result.
+func collectSink(result *[][]float64) pipe.SinkAllocatorFunc {
+	return func(mctx mutable.Context, bufferSize int, props pipe.SignalProperties) (pipe.Sink, error) {
+		*result = make([][]float64, props.Channels)
+		return pipe.Sink{
+			SinkFunc: func(in signal.Floating) error {
+				for c := range *result {
+					for i := 0; i < in.Length(); i++ {
+						(*result)[c] = append((*result)[c], in.Sample(in.BufferIndex(c, i)))
+					}
+				}
+				return nil
+			},
+		}, nil
+	}
 }
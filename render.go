@@ -0,0 +1,143 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"pipelined.dev/pipe"
+	"pipelined.dev/pipe/mutable"
+	"pipelined.dev/signal"
+)
+
+// StemSinkFunc returns the sink that receives the signal of the plugin
+// output bus. Name is unique among the stems of the render.
+type StemSinkFunc func(name string, bus Bus) pipe.SinkAllocatorFunc
+
+// RenderStems processes the source with the plugin and writes every plugin
+// output bus into its own sink. The source is wrapped with Processor.Source,
+// so latency compensation and tail work as in the pipe line. Plugin outputs
+// are not mapped, the output part of Processor.Channels is ignored.
+func (p *Processor) RenderStems(ctx context.Context, bufferSize int, source pipe.SourceAllocatorFunc, stems StemSinkFunc) (err error) {
+	var mctx mutable.Context
+	src, err := p.Source(source)(mctx, bufferSize)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	proc, err := p.allocator(nil, true)(mctx, bufferSize, src.SignalProperties)
+	if err != nil {
+		return fmt.Errorf("processor: %w", err)
+	}
+	buses := p.plugin.OutputBuses()
+	sinks := make([]pipe.Sink, len(buses))
+	names := stemNames(buses)
+	for i, b := range buses {
+		props := pipe.SignalProperties{
+			Channels:   len(b.Pins),
+			SampleRate: proc.SampleRate,
+		}
+		if sinks[i], err = stems(names[i], b)(mctx, bufferSize, props); err != nil {
+			return fmt.Errorf("stem %s: %w", names[i], err)
+		}
+	}
+
+	starts := []pipe.StartFunc{src.StartFunc, proc.StartFunc}
+	flushes := []pipe.FlushFunc{src.FlushFunc, proc.FlushFunc}
+	for _, s := range sinks {
+		starts = append(starts, s.StartFunc)
+		flushes = append(flushes, s.FlushFunc)
+	}
+	defer func() {
+		for _, fn := range flushes {
+			if fn == nil {
+				continue
+			}
+			if flushErr := fn(ctx); flushErr != nil && err == nil {
+				err = flushErr
+			}
+		}
+	}()
+	for _, fn := range starts {
+		if fn == nil {
+			continue
+		}
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+
+	in := signal.Allocator{Channels: src.Channels, Length: bufferSize, Capacity: bufferSize}.Float64()
+	out := signal.Allocator{Channels: proc.Channels, Length: bufferSize, Capacity: bufferSize}.Float64()
+	stemBuffers := make([]signal.Floating, len(buses))
+	for i, b := range buses {
+		stemBuffers[i] = signal.Allocator{Channels: len(b.Pins), Length: bufferSize, Capacity: bufferSize}.Float64()
+	}
+	row := make([]float64, bufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		read, err := src.SourceFunc(in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		processed, err := proc.ProcessFunc(in.Slice(0, read), out)
+		if err != nil {
+			return err
+		}
+		for i, b := range buses {
+			stem := stemBuffers[i].Slice(0, processed)
+			for c, pin := range b.Pins {
+				readChannel(out, pin, 0, row[:processed])
+				writeChannel(stem, c, 0, row[:processed])
+			}
+			if err := sinks[i].SinkFunc(stem); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StemName returns the name of output bus. Label is preferred over
+// ShortLabel. Channel suffix of the stereo bus label is removed.
+func StemName(b Bus) string {
+	name := strings.TrimSpace(b.Label)
+	if name == "" {
+		name = strings.TrimSpace(b.ShortLabel)
+	}
+	if b.Stereo() {
+		for _, suffix := range []string{" Left", " L", ".L", "-L", "_L"} {
+			if trimmed := strings.TrimSuffix(name, suffix); trimmed != name && trimmed != "" {
+				name = strings.TrimSpace(trimmed)
+				break
+			}
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("Output %d", b.Index+1)
+	}
+	return name
+}
+
+// stemNames returns unique names of the output buses.
+func stemNames(buses []Bus) []string {
+	names := make([]string, len(buses))
+	used := make(map[string]int, len(buses))
+	for i, b := range buses {
+		name := StemName(b)
+		used[name]++
+		if n := used[name]; n > 1 {
+			name = fmt.Sprintf("%s %d", name, n)
+		}
+		names[i] = name
+	}
+	return names
+}
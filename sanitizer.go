@@ -0,0 +1,185 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import "math"
+
+// SanitizePolicy defines how invalid samples of the plugin output are
+// replaced.
+type SanitizePolicy int
+
+const (
+	// SanitizeZero replaces invalid samples with zero.
+	SanitizeZero SanitizePolicy = iota
+	// SanitizeClamp replaces infinities with the sanitizer limit of the
+	// same sign, NaNs and denormals with zero.
+	SanitizeClamp
+	// SanitizeMute silences all channels of the block that has invalid
+	// samples.
+	SanitizeMute
+)
+
+const (
+	// DefaultSanitizeLimit is the clamp limit, 0 dBFS.
+	DefaultSanitizeLimit = 1.0
+	// minNormalFloat64 is the smallest positive normal float64.
+	minNormalFloat64 = 0x1p-1022
+	// minNormalFloat32 is the smallest positive normal float32.
+	minNormalFloat32 = 0x1p-126
+)
+
+type (
+	// Sanitizer detects NaN, Inf and denormal samples in the plugin
+	// output, replaces them according to the policy and reports the
+	// incidents.
+	Sanitizer struct {
+		Policy SanitizePolicy
+		// Limit is the absolute value infinities are clamped to.
+		// DefaultSanitizeLimit is used if zero.
+		Limit float64
+		// Incident is called for every channel that has invalid
+		// samples. It's called from the processing goroutine.
+		Incident IncidentFunc
+	}
+
+	// Incident describes invalid samples in a single channel of the
+	// plugin output block.
+	Incident struct {
+		Plugin   *Plugin
+		UniqueID int32
+		Name     string
+		// Position is the number of frames processed by plugin before
+		// the block.
+		Position  int64
+		Frames    int
+		Channel   int
+		NaN       int
+		Inf       int
+		Denormals int
+	}
+
+	// IncidentFunc receives sanitizer incidents.
+	IncidentFunc func(Incident)
+)
+
+// SetSanitizer enables sanitizing of the plugin output in ProcessDouble
+// and ProcessFloat calls. Nil disables it. Incident positions are counted
+// from this call. Plugin name is resolved once, when sanitizer is set.
+func (p *Plugin) SetSanitizer(s *Sanitizer) {
+	p.sanitizer = s
+	p.processed = 0
+	if s != nil {
+		p.uniqueID = p.UniqueID()
+		p.name = p.GetPluginName()
+	}
+}
+
+// sanitizeDouble checks the output after process call.
+func (p *Plugin) sanitizeDouble(out DoubleBuffer) {
+	if p.sanitizer != nil {
+		var invalid bool
+		for c := range out.data {
+			i := p.sanitizer.incident(p, c, out.Frames)
+			p.sanitizer.double(out.Channel(c)[:out.Frames], &i)
+			invalid = p.sanitizer.report(i) || invalid
+		}
+		if invalid && p.sanitizer.Policy == SanitizeMute {
+			for c := range out.data {
+				zero(out.Channel(c)[:out.Frames])
+			}
+		}
+	}
+	p.processed += int64(out.Frames)
+}
+
+// sanitizeFloat checks the output after process call.
+func (p *Plugin) sanitizeFloat(out FloatBuffer) {
+	if p.sanitizer != nil {
+		var invalid bool
+		for c := range out.data {
+			i := p.sanitizer.incident(p, c, out.Frames)
+			p.sanitizer.float(out.Channel(c)[:out.Frames], &i)
+			invalid = p.sanitizer.report(i) || invalid
+		}
+		if invalid && p.sanitizer.Policy == SanitizeMute {
+			for c := range out.data {
+				row := out.Channel(c)[:out.Frames]
+				for i := range row {
+					row[i] = 0
+				}
+			}
+		}
+	}
+	p.processed += int64(out.Frames)
+}
+
+func (s *Sanitizer) incident(p *Plugin, channel, frames int) Incident {
+	return Incident{
+		Plugin:   p,
+		UniqueID: p.uniqueID,
+		Name:     p.name,
+		Position: p.processed,
+		Frames:   frames,
+		Channel:  channel,
+	}
+}
+
+// report calls incident callback if channel has invalid samples.
+func (s *Sanitizer) report(i Incident) bool {
+	if i.NaN+i.Inf+i.Denormals == 0 {
+		return false
+	}
+	if s.Incident != nil {
+		s.Incident(i)
+	}
+	return true
+}
+
+// double counts and replaces invalid samples.
+func (s *Sanitizer) double(row []float64, i *Incident) {
+	for j, v := range row {
+		switch {
+		case v != v:
+			i.NaN++
+			row[j] = 0
+		case math.IsInf(v, 0):
+			i.Inf++
+			row[j] = s.replaceInf(v)
+		case v != 0 && v > -minNormalFloat64 && v < minNormalFloat64:
+			i.Denormals++
+			row[j] = 0
+		}
+	}
+}
+
+// float counts and replaces invalid samples.
+func (s *Sanitizer) float(row []float32, i *Incident) {
+	for j, v := range row {
+		switch {
+		case v != v:
+			i.NaN++
+			row[j] = 0
+		case math.IsInf(float64(v), 0):
+			i.Inf++
+			row[j] = float32(s.replaceInf(float64(v)))
+		case v != 0 && v > -minNormalFloat32 && v < minNormalFloat32:
+			i.Denormals++
+			row[j] = 0
+		}
+	}
+}
+
+func (s *Sanitizer) replaceInf(v float64) float64 {
+	if s.Policy != SanitizeClamp {
+		return 0
+	}
+	limit := s.Limit
+	if limit <= 0 {
+		limit = DefaultSanitizeLimit
+	}
+	if v < 0 {
+		return -limit
+	}
+	return limit
+}
@@ -0,0 +1,139 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+func TestSanitizer(t *testing.T) {
+	path := skipIfNoPlugin(t)
+	v, err := vst2.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	const channels = 2
+	input := []float64{1, math.NaN(), math.Inf(1), math.Inf(-1), 1e-310, 0.5}
+	clean := []float64{1, 1, 1, 1, 1, 1}
+	frames := len(input)
+
+	tests := []struct {
+		name     string
+		policy   vst2.SanitizePolicy
+		expected [][]float64
+	}{
+		{
+			name:     "zero",
+			policy:   vst2.SanitizeZero,
+			expected: [][]float64{{1, 0, 0, 0, 0, 0.5}, clean},
+		},
+		{
+			name:     "clamp",
+			policy:   vst2.SanitizeClamp,
+			expected: [][]float64{{1, 0, 2, -2, 0, 0.5}, clean},
+		},
+		{
+			name:     "mute",
+			policy:   vst2.SanitizeMute,
+			expected: [][]float64{make([]float64, frames), make([]float64, frames)},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			p := v.Plugin(vst2.NoopHostCallback())
+			defer p.Close()
+			p.Start()
+			p.SetBufferSize(frames)
+			p.Resume()
+			var incidents []vst2.Incident
+			p.SetSanitizer(&vst2.Sanitizer{
+				Policy: test.policy,
+				Limit:  2,
+				Incident: func(i vst2.Incident) {
+					incidents = append(incidents, i)
+				},
+			})
+
+			in := vst2.NewDoubleBuffer(channels, frames)
+			defer in.Free()
+			out := vst2.NewDoubleBuffer(channels, frames)
+			defer out.Free()
+			for i := 0; i < 2; i++ {
+				copy(in.Channel(0), input)
+				copy(in.Channel(1), clean)
+				p.ProcessDouble(in, out)
+				assertEqual(t, "channel 0", out.Channel(0), test.expected[0])
+				assertEqual(t, "channel 1", out.Channel(1), test.expected[1])
+			}
+			assertEqual(t, "incidents", len(incidents), 2)
+			for i, incident := range incidents {
+				assertEqual(t, "position", incident.Position, int64(i*frames))
+				assertEqual(t, "channel", incident.Channel, 0)
+				assertEqual(t, "nan", incident.NaN, 1)
+				assertEqual(t, "inf", incident.Inf, 2)
+				assertEqual(t, "denormals", incident.Denormals, 1)
+				assertEqual(t, "plugin", incident.Plugin, p)
+				assertEqual(t, "unique id", incident.UniqueID, p.UniqueID())
+				assertEqual(t, "name", incident.Name, p.GetPluginName())
+			}
+		})
+	}
+
+	t.Run("float", func(t *testing.T) {
+		t.Parallel()
+		p := v.Plugin(vst2.NoopHostCallback())
+		defer p.Close()
+		p.Start()
+		p.SetBufferSize(frames)
+		p.Resume()
+		var incident vst2.Incident
+		p.SetSanitizer(&vst2.Sanitizer{
+			Incident: func(i vst2.Incident) {
+				incident = i
+			},
+		})
+		in := vst2.NewFloatBuffer(channels, frames)
+		defer in.Free()
+		out := vst2.NewFloatBuffer(channels, frames)
+		defer out.Free()
+		copy(in.Channel(0), []float32{1, float32(math.NaN()), float32(math.Inf(1)), 1e-40, 0.5, 1})
+		p.ProcessFloat(in, out)
+		assertEqual(t, "channel 0", out.Channel(0), []float32{1, 0, 0, 0, 0.5, 1})
+		assertEqual(t, "nan", incident.NaN, 1)
+		assertEqual(t, "inf", incident.Inf, 1)
+		assertEqual(t, "denormals", incident.Denormals, 1)
+	})
+
+	t.Run("float plugin", func(t *testing.T) {
+		t.Parallel()
+		p := v.Plugin(vst2.NoopHostCallback())
+		defer p.Close()
+		vst2.RemoveProcessDouble(p)
+		p.Start()
+		p.SetBufferSize(frames)
+		p.Resume()
+		var incident vst2.Incident
+		p.SetSanitizer(&vst2.Sanitizer{
+			Incident: func(i vst2.Incident) {
+				incident = i
+			},
+		})
+		in := vst2.NewDoubleBuffer(channels, frames)
+		defer in.Free()
+		out := vst2.NewDoubleBuffer(channels, frames)
+		defer out.Free()
+		// normal double becomes float denormal.
+		copy(in.Channel(0), []float64{1, 1e-40, 0.5, 1, 1, 1})
+		p.ProcessDouble(in, out)
+		assertEqual(t, "channel 0", out.Channel(0), []float64{1, 0, 0.5, 1, 1, 1})
+		assertEqual(t, "denormals", incident.Denormals, 1)
+	})
+}
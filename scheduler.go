@@ -0,0 +1,181 @@
+package vst2
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultSchedulerCapacity is the default number of events scheduler can
+// hold without allocations.
+const DefaultSchedulerCapacity = 256
+
+// controllerAllNotesOff is the All Notes Off channel mode message.
+const controllerAllNotesOff = 123
+
+type (
+	// EventScheduler delivers events addressed by absolute sample
+	// positions in blocks. Events can be scheduled from any goroutine.
+	// Scheduler keeps copies of events. Schedule allocates only if the
+	// number of pending events exceeds the capacity and Next allocates
+	// only if the block has more events than the capacity. Stop can
+	// schedule up to 16*128 note offs and 16 All Notes Off messages.
+	// SysEx dumps must stay valid until the event is delivered. Zero
+	// value has zero capacity.
+	EventScheduler struct {
+		mu      sync.Mutex
+		pending []scheduledEvent
+		// held notes per channel, tracked from delivered events.
+		held   [16][128]bool
+		events EventsBuffer
+	}
+
+	scheduledEvent struct {
+		position int64
+		eventType
+		midi  MIDIEvent
+		sysex SysExMIDIEvent
+	}
+)
+
+// NewEventScheduler returns scheduler that holds provided number of events
+// without allocations. DefaultSchedulerCapacity is used if capacity is not
+// positive. Scheduler must be freed after use.
+func NewEventScheduler(capacity int) *EventScheduler {
+	if capacity <= 0 {
+		capacity = DefaultSchedulerCapacity
+	}
+	s := EventScheduler{
+		pending: make([]scheduledEvent, 0, capacity),
+	}
+	s.events.reserve(capacity)
+	return &s
+}
+
+// Schedule adds copies of events. Events with equal positions keep the
+// order they were scheduled in. Events of unknown types are ignored.
+func (s *EventScheduler) Schedule(events ...TimedEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		se := scheduledEvent{position: e.Position}
+		switch ev := e.Event.(type) {
+		case *MIDIEvent:
+			se.eventType, se.midi = MIDI, *ev
+		case *SysExMIDIEvent:
+			se.eventType, se.sysex = SysExMIDI, *ev
+		default:
+			continue
+		}
+		s.insert(se)
+	}
+}
+
+// Next removes events positioned before the end of the block and returns
+// them with DeltaFrames relative to the block start. Events with positions
+// before the block start are delivered at its start. Returns nil if there
+// are no events in the block. Container is valid until the next call.
+func (s *EventScheduler) Next(start int64, frames int) *EventsPtr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	end := start + int64(frames)
+	n := sort.Search(len(s.pending), func(i int) bool {
+		return s.pending[i].position >= end
+	})
+	if n == 0 {
+		return nil
+	}
+	s.events.reserve(n)
+	s.events.Reset()
+	for i := 0; i < n; i++ {
+		e := &s.pending[i]
+		delta := int32(0)
+		if e.position > start {
+			delta = int32(e.position - start)
+		}
+		switch e.eventType {
+		case MIDI:
+			e.midi.DeltaFrames = delta
+			s.events.Append(&e.midi)
+			s.track(e.midi.Data)
+		case SysExMIDI:
+			e.sysex.DeltaFrames = delta
+			s.events.Append(&e.sysex)
+		}
+	}
+	s.pending = s.pending[:copy(s.pending, s.pending[n:])]
+	return s.events.Events()
+}
+
+// Flush drops all pending events.
+func (s *EventScheduler) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = s.pending[:0]
+}
+
+// Stop drops all pending events and schedules note off for every held
+// note followed by All Notes Off on every channel at provided position.
+func (s *EventScheduler) Stop(position int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = s.pending[:0]
+	for channel := range s.held {
+		for key, held := range s.held[channel] {
+			if held {
+				s.insert(scheduledEvent{
+					position:  position,
+					eventType: MIDI,
+					midi:      MIDIEvent{Data: NoteOff{Channel: uint8(channel), Key: uint8(key)}.Data()},
+				})
+			}
+		}
+	}
+	for channel := range s.held {
+		s.insert(scheduledEvent{
+			position:  position,
+			eventType: MIDI,
+			midi:      MIDIEvent{Data: ControlChange{Channel: uint8(channel), Controller: controllerAllNotesOff}.Data()},
+		})
+		s.held[channel] = [128]bool{}
+	}
+}
+
+// Len returns the number of pending events.
+func (s *EventScheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Free releases the events container. Pending events are kept and the
+// container is allocated again by the next call of Next.
+func (s *EventScheduler) Free() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events.Free()
+}
+
+// insert adds event after all events with lower or equal position.
+func (s *EventScheduler) insert(e scheduledEvent) {
+	i := sort.Search(len(s.pending), func(i int) bool {
+		return s.pending[i].position > e.position
+	})
+	s.pending = append(s.pending, scheduledEvent{})
+	copy(s.pending[i+1:], s.pending[i:])
+	s.pending[i] = e
+}
+
+// track updates held notes with delivered event.
+func (s *EventScheduler) track(data [3]byte) {
+	channel, key := data[0]&0x0F, data[1]&0x7F
+	switch data[0] & 0xF0 {
+	case midiNoteOn:
+		s.held[channel][key] = data[2] != 0
+	case midiNoteOff:
+		s.held[channel][key] = false
+	case midiControlChange:
+		if data[1] == controllerAllNotesOff {
+			s.held[channel] = [128]bool{}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package vst2_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+func TestEventScheduler(t *testing.T) {
+	t.Parallel()
+	note := func(position int64, key uint8) vst2.TimedEvent {
+		return vst2.TimedEvent{
+			Position: position,
+			Event:    vst2.NewMIDIEvent(0, vst2.NoteOn{Key: key, Velocity: 100}),
+		}
+	}
+	type delivered struct {
+		delta int32
+		data  [3]byte
+	}
+	collect := func(events *vst2.EventsPtr) []delivered {
+		if events == nil {
+			return nil
+		}
+		result := make([]delivered, events.NumEvents())
+		for i := range result {
+			e := events.Event(i).(*vst2.MIDIEvent)
+			result[i] = delivered{delta: e.DeltaFrames, data: e.Data}
+		}
+		return result
+	}
+
+	t.Run("blocks", func(t *testing.T) {
+		t.Parallel()
+		s := vst2.NewEventScheduler(4)
+		defer s.Free()
+		s.Schedule(note(20, 3), note(5, 1), note(12, 2), note(5, 4))
+		assertEqual(t, "first", collect(s.Next(0, 10)), []delivered{
+			{delta: 5, data: vst2.NoteOn{Key: 1, Velocity: 100}.Data()},
+			{delta: 5, data: vst2.NoteOn{Key: 4, Velocity: 100}.Data()},
+		})
+		assertEqual(t, "second", collect(s.Next(10, 10)), []delivered{
+			{delta: 2, data: vst2.NoteOn{Key: 2, Velocity: 100}.Data()},
+		})
+		assertEqual(t, "pending", s.Len(), 1)
+		// late event is delivered at the block start.
+		s.Schedule(note(15, 5))
+		assertEqual(t, "third", collect(s.Next(20, 10)), []delivered{
+			{delta: 0, data: vst2.NoteOn{Key: 5, Velocity: 100}.Data()},
+			{delta: 0, data: vst2.NoteOn{Key: 3, Velocity: 100}.Data()},
+		})
+		if s.Next(30, 10) != nil {
+			t.Fatalf("expected no events")
+		}
+	})
+
+	t.Run("sysex", func(t *testing.T) {
+		t.Parallel()
+		s := vst2.NewEventScheduler(0)
+		defer s.Free()
+		dump := vst2.SysExData([]byte{0xF0, 0xF7})
+		defer dump.Free()
+		s.Schedule(
+			note(70, 1),
+			note(10, 2),
+			vst2.TimedEvent{Position: 10, Event: &vst2.SysExMIDIEvent{SysExDump: dump}},
+		)
+		events := s.Next(0, 64)
+		assertEqual(t, "events", events.NumEvents(), 2)
+		assertEqual(t, "note", events.Event(0).(*vst2.MIDIEvent).DeltaFrames, int32(10))
+		sysex := events.Event(1).(*vst2.SysExMIDIEvent)
+		assertEqual(t, "sysex delta", sysex.DeltaFrames, int32(10))
+		assertEqual(t, "sysex data", sysex.SysExDump.Bytes(), []byte{0xF0, 0xF7})
+		assertEqual(t, "next block", collect(s.Next(64, 64)), []delivered{
+			{delta: 6, data: vst2.NoteOn{Key: 1, Velocity: 100}.Data()},
+		})
+	})
+
+	t.Run("reuse after free", func(t *testing.T) {
+		t.Parallel()
+		s := vst2.NewEventScheduler(0)
+		s.Schedule(note(1, 1))
+		s.Free()
+		defer s.Free()
+		assertEqual(t, "events", len(collect(s.Next(0, 10))), 1)
+	})
+
+	t.Run("grow", func(t *testing.T) {
+		t.Parallel()
+		s := vst2.NewEventScheduler(1)
+		defer s.Free()
+		for i := 0; i < 10; i++ {
+			s.Schedule(note(int64(i), uint8(i)))
+		}
+		assertEqual(t, "events", len(collect(s.Next(0, 10))), 10)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		t.Parallel()
+		s := vst2.NewEventScheduler(0)
+		defer s.Free()
+		s.Schedule(note(1, 1), note(2, 2))
+		s.Flush()
+		assertEqual(t, "pending", s.Len(), 0)
+		if s.Next(0, 10) != nil {
+			t.Fatalf("expected no events")
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		t.Parallel()
+		s := vst2.NewEventScheduler(0)
+		defer s.Free()
+		s.Schedule(
+			note(0, 60),
+			note(1, 61),
+			vst2.TimedEvent{Position: 2, Event: vst2.NewMIDIEvent(0, vst2.NoteOff{Key: 60})},
+			note(100, 62),
+		)
+		s.Next(0, 10)
+		s.Stop(15)
+		events := collect(s.Next(10, 10))
+		assertEqual(t, "events", len(events), 17)
+		assertEqual(t, "note off", events[0], delivered{
+			delta: 5,
+			data:  vst2.NoteOff{Key: 61}.Data(),
+		})
+		for i, e := range events[1:] {
+			assertEqual(t, "all notes off", e, delivered{
+				delta: 5,
+				data:  vst2.ControlChange{Channel: uint8(i), Controller: 123}.Data(),
+			})
+		}
+		s.Stop(20)
+		assertEqual(t, "no held notes", len(collect(s.Next(20, 10))), 16)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		t.Parallel()
+		s := vst2.NewEventScheduler(0)
+		defer s.Free()
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					s.Schedule(note(int64(j), uint8(i)))
+				}
+			}(i)
+		}
+		wg.Wait()
+		events := collect(s.Next(0, 10))
+		assertEqual(t, "events", len(events), 40)
+		for i := range events {
+			assertEqual(t, "delta", events[i].delta, int32(i/4))
+		}
+	})
+}
+
+// TestEventSchedulerAllocations is not parallel to count allocations of
+// the scheduler only.
+func TestEventSchedulerAllocations(t *testing.T) {
+	note := func(position int64, key uint8) vst2.TimedEvent {
+		return vst2.TimedEvent{
+			Position: position,
+			Event:    vst2.NewMIDIEvent(0, vst2.NoteOn{Key: key, Velocity: 100}),
+		}
+	}
+	s := vst2.NewEventScheduler(0)
+	defer s.Free()
+	events := []vst2.TimedEvent{note(0, 1), note(3, 2), note(7, 3)}
+	var position int64
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := range events {
+			events[i].Position = position + int64(i)
+		}
+		s.Schedule(events...)
+		s.Next(position, 10)
+		position += 10
+	})
+	assertEqual(t, "allocations", allocs, float64(0))
+}
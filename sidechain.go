@@ -0,0 +1,155 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import (
+	"context"
+	"sync"
+
+	"pipelined.dev/pipe"
+	"pipelined.dev/pipe/mutable"
+	"pipelined.dev/signal"
+)
+
+// sidechainBuffers is the number of sink buffers that sidechain can hold
+// before the sink blocks.
+const sidechainBuffers = 4
+
+// Sidechain passes the signal of another line into the plugin input bus.
+// Processor reads the sidechain synchronously with its own input, so both
+// lines must run at the same time and must not share mutable context.
+type Sidechain struct {
+	// Bus selects the plugin input bus fed by sidechain. SidechainBus is
+	// used if nil. Mono sidechain feeds every pin of the bus. Otherwise
+	// pins receive the channels with the same index, missing channels
+	// are silent.
+	Bus BusFunc
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// data holds buffered frames per channel.
+	data [][]float64
+	// ended is set when the sidechain line is done.
+	ended bool
+	// closed is set when processor is done, sink discards frames.
+	closed bool
+}
+
+// Sink returns pipe sink that feeds sidechain. It must be used in the line
+// that runs together with the line of processor.
+func (s *Sidechain) Sink() pipe.SinkAllocatorFunc {
+	return func(mctx mutable.Context, bufferSize int, props pipe.SignalProperties) (pipe.Sink, error) {
+		s.mu.Lock()
+		s.init()
+		s.data = make([][]float64, props.Channels)
+		for c := range s.data {
+			s.data[c] = make([]float64, 0, sidechainBuffers*bufferSize)
+		}
+		s.ended = false
+		s.mu.Unlock()
+		return pipe.Sink{
+			SinkFunc: s.write,
+			FlushFunc: func(context.Context) error {
+				s.mu.Lock()
+				s.ended = true
+				s.cond.Broadcast()
+				s.mu.Unlock()
+				return nil
+			},
+		}, nil
+	}
+}
+
+// init initializes condition variable. Must be called under lock.
+func (s *Sidechain) init() {
+	if s.cond == nil {
+		s.cond = sync.NewCond(&s.mu)
+	}
+}
+
+// open prepares sidechain for the processor run.
+func (s *Sidechain) open() {
+	s.mu.Lock()
+	s.init()
+	s.closed = false
+	s.mu.Unlock()
+}
+
+// close releases the sink if it waits for processor.
+func (s *Sidechain) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// length returns the number of buffered frames. Must be called under lock.
+func (s *Sidechain) length() int {
+	if len(s.data) == 0 {
+		return 0
+	}
+	return len(s.data[0])
+}
+
+// write appends the signal to the buffered frames. It blocks while the
+// buffer is full.
+func (s *Sidechain) write(in signal.Floating) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for offset := 0; offset < in.Length(); {
+		for !s.closed && s.length() == cap(s.data[0]) {
+			s.cond.Wait()
+		}
+		if s.closed {
+			return nil
+		}
+		length := s.length()
+		n := min(cap(s.data[0])-length, in.Length()-offset)
+		for c := range s.data {
+			s.data[c] = s.data[c][:length+n]
+			readChannel(in, c, offset, s.data[c][length:])
+		}
+		offset += n
+		s.cond.Broadcast()
+	}
+	return nil
+}
+
+// read fills provided pins of the buffer with sidechain frames. It blocks
+// until enough frames are buffered or the sidechain line is done. Frames
+// after the end of sidechain are silent.
+func (s *Sidechain) read(b DoubleBuffer, pins []int, frames int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for read := 0; read < frames; {
+		for !s.ended && s.length() == 0 {
+			s.cond.Wait()
+		}
+		n := min(s.length(), frames-read)
+		for i, pin := range pins {
+			row := b.Channel(pin)[read:frames]
+			switch {
+			case len(s.data) == 1:
+				copy(row[:n], s.data[0])
+			case i < len(s.data):
+				copy(row[:n], s.data[i])
+			default:
+				zero(row[:n])
+			}
+			if n == 0 {
+				// sidechain is done.
+				zero(row)
+			}
+		}
+		if n == 0 {
+			return
+		}
+		for c := range s.data {
+			length := copy(s.data[c], s.data[c][n:])
+			s.data[c] = s.data[c][:length]
+		}
+		read += n
+		s.cond.Broadcast()
+	}
+}
@@ -0,0 +1,286 @@
+package vst2
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	"pipelined.dev/signal"
+)
+
+const (
+	// defaultTempo is 120 BPM in microseconds per quarter note.
+	defaultTempo   = 500000
+	metaEndOfTrack = 0x2F
+	metaTempo      = 0x51
+)
+
+type (
+	// SMF is a Standard MIDI File with events positioned in samples.
+	SMF struct {
+		// Format is 0 for single track and 1 for multiple simultaneous
+		// tracks.
+		Format int
+		// Tracks is the number of tracks in the file.
+		Tracks int
+		// Events are MIDI channel and real-time events of all tracks
+		// sorted by position. Events with equal positions keep the
+		// order of tracks. SysEx and meta events are not included.
+		Events []TimedEvent
+		// Length is the position of the latest end of track.
+		Length int64
+	}
+
+	// smfEvent is an event positioned in ticks.
+	smfEvent struct {
+		tick  int64
+		track int
+		data  [3]byte
+	}
+
+	// tempoChange is a tempo meta event.
+	tempoChange struct {
+		tick  int64
+		tempo int64
+	}
+
+	// smfTiming converts ticks into seconds.
+	smfTiming struct {
+		// ticksPerQuarter is set for metrical timing.
+		ticksPerQuarter int64
+		// ticksPerSecond is set for SMPTE timing.
+		ticksPerSecond float64
+		tempos         []tempoChange
+	}
+)
+
+// ReadSMF reads Standard MIDI File of format 0 or 1. Ticks are converted
+// into sample positions at provided sample rate with the file tempo map.
+func ReadSMF(r io.Reader, sampleRate signal.Frequency) (*SMF, error) {
+	br := bufio.NewReader(r)
+	id, header, err := readChunk(br)
+	if err != nil {
+		return nil, fmt.Errorf("error reading header: %w", err)
+	}
+	if id != "MThd" || len(header) < 6 {
+		return nil, errors.New("missing SMF header")
+	}
+	format := int(binary.BigEndian.Uint16(header[0:]))
+	tracks := int(binary.BigEndian.Uint16(header[2:]))
+	division := binary.BigEndian.Uint16(header[4:])
+	if format > 1 {
+		return nil, fmt.Errorf("unsupported SMF format: %d", format)
+	}
+	var timing smfTiming
+	if division&0x8000 == 0 {
+		if division == 0 {
+			return nil, errors.New("invalid SMF division")
+		}
+		timing.ticksPerQuarter = int64(division)
+	} else {
+		fps := float64(-int8(division >> 8))
+		if fps <= 0 || division&0xFF == 0 {
+			return nil, errors.New("invalid SMF division")
+		}
+		if fps == 29 {
+			fps = 29.97
+		}
+		timing.ticksPerSecond = fps * float64(division&0xFF)
+	}
+
+	var (
+		events []smfEvent
+		end    int64
+	)
+	for track := 0; track < tracks; {
+		id, data, err := readChunk(br)
+		if err != nil {
+			return nil, fmt.Errorf("error reading track %d: %w", track, err)
+		}
+		// unknown chunks are skipped.
+		if id != "MTrk" {
+			continue
+		}
+		trackEvents, tempos, trackEnd, err := parseTrack(data, track)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing track %d: %w", track, err)
+		}
+		events = append(events, trackEvents...)
+		timing.tempos = append(timing.tempos, tempos...)
+		if trackEnd > end {
+			end = trackEnd
+		}
+		track++
+	}
+
+	sort.SliceStable(timing.tempos, func(i, j int) bool {
+		return timing.tempos[i].tick < timing.tempos[j].tick
+	})
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].tick != events[j].tick {
+			return events[i].tick < events[j].tick
+		}
+		return events[i].track < events[j].track
+	})
+	smf := SMF{
+		Format: format,
+		Tracks: tracks,
+		Events: make([]TimedEvent, len(events)),
+		Length: timing.position(end, sampleRate),
+	}
+	for i, e := range events {
+		smf.Events[i] = TimedEvent{
+			Position: timing.position(e.tick, sampleRate),
+			Event:    &MIDIEvent{Data: e.data},
+		}
+	}
+	return &smf, nil
+}
+
+// readChunk reads the chunk id and data. Chunk length is not trusted,
+// data grows with the bytes actually read.
+func readChunk(r io.Reader) (string, []byte, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", nil, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[4:]))
+	data, err := ioutil.ReadAll(io.LimitReader(r, length))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(data)) < length {
+		return "", nil, io.ErrUnexpectedEOF
+	}
+	return string(header[:4]), data, nil
+}
+
+// parseTrack returns channel and real-time events, tempo changes and the
+// tick of the track end.
+func parseTrack(data []byte, track int) ([]smfEvent, []tempoChange, int64, error) {
+	var (
+		events  []smfEvent
+		tempos  []tempoChange
+		tick    int64
+		running byte
+		pos     int
+	)
+	for pos < len(data) {
+		delta, n, err := readVLQ(data[pos:])
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		pos += n
+		tick += int64(delta)
+		if pos >= len(data) {
+			return nil, nil, 0, io.ErrUnexpectedEOF
+		}
+		status := data[pos]
+		switch {
+		case status == 0xFF:
+			if pos+2 > len(data) {
+				return nil, nil, 0, io.ErrUnexpectedEOF
+			}
+			kind := data[pos+1]
+			length, n, err := readVLQ(data[pos+2:])
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			start := pos + 2 + n
+			if start+length > len(data) {
+				return nil, nil, 0, io.ErrUnexpectedEOF
+			}
+			meta := data[start : start+length]
+			pos = start + length
+			switch kind {
+			case metaTempo:
+				if len(meta) == 3 {
+					tempo := int64(meta[0])<<16 | int64(meta[1])<<8 | int64(meta[2])
+					tempos = append(tempos, tempoChange{tick: tick, tempo: tempo})
+				}
+			case metaEndOfTrack:
+				return events, tempos, tick, nil
+			}
+		case status == 0xF0 || status == 0xF7:
+			// SysEx events are skipped.
+			length, n, err := readVLQ(data[pos+1:])
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			if pos+1+n+length > len(data) {
+				return nil, nil, 0, io.ErrUnexpectedEOF
+			}
+			pos += 1 + n + length
+			running = 0
+		case status >= 0xF8:
+			events = append(events, smfEvent{tick: tick, track: track, data: [3]byte{status}})
+			pos++
+		default:
+			if status >= 0x80 {
+				if status >= 0xF0 {
+					return nil, nil, 0, fmt.Errorf("unsupported status byte: %#x", status)
+				}
+				running = status
+				pos++
+			} else if running == 0 {
+				return nil, nil, 0, errors.New("running status without status byte")
+			}
+			size := 2
+			if kind := running & 0xF0; kind == midiProgramChange || kind == midiChannelPressure {
+				size = 1
+			}
+			if pos+size > len(data) {
+				return nil, nil, 0, io.ErrUnexpectedEOF
+			}
+			e := smfEvent{tick: tick, track: track, data: [3]byte{running}}
+			copy(e.data[1:], data[pos:pos+size])
+			events = append(events, e)
+			pos += size
+		}
+	}
+	return events, tempos, tick, nil
+}
+
+// readVLQ reads variable-length quantity and returns its value and the
+// number of bytes read.
+func readVLQ(data []byte) (int, int, error) {
+	var value int
+	for i := 0; i < len(data) && i < 4; i++ {
+		value = value<<7 | int(data[i]&0x7F)
+		if data[i]&0x80 == 0 {
+			return value, i + 1, nil
+		}
+	}
+	return 0, 0, errors.New("invalid variable-length quantity")
+}
+
+// position converts ticks into samples.
+func (t smfTiming) position(tick int64, sampleRate signal.Frequency) int64 {
+	return int64(math.Round(t.seconds(tick) * float64(sampleRate)))
+}
+
+// seconds converts ticks into seconds. Tempo changes are applied for
+// metrical timing.
+func (t smfTiming) seconds(tick int64) float64 {
+	if t.ticksPerQuarter == 0 {
+		return float64(tick) / t.ticksPerSecond
+	}
+	var (
+		seconds  float64
+		lastTick int64
+		tempo    int64 = defaultTempo
+	)
+	for _, c := range t.tempos {
+		if c.tick >= tick {
+			break
+		}
+		seconds += float64(c.tick-lastTick) * float64(tempo) / float64(t.ticksPerQuarter) / 1e6
+		lastTick, tempo = c.tick, c.tempo
+	}
+	return seconds + float64(tick-lastTick)*float64(tempo)/float64(t.ticksPerQuarter)/1e6
+}
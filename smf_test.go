@@ -0,0 +1,140 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cwbudde/vst2"
+)
+
+// smfFile builds SMF with provided tracks data.
+func smfFile(format, division uint16, tracks ...[]byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("MThd")
+	binary.Write(&b, binary.BigEndian, uint32(6))
+	binary.Write(&b, binary.BigEndian, [3]uint16{format, uint16(len(tracks)), division})
+	for _, t := range tracks {
+		b.WriteString("MTrk")
+		binary.Write(&b, binary.BigEndian, uint32(len(t)))
+		b.Write(t)
+	}
+	return b.Bytes()
+}
+
+func TestSMF(t *testing.T) {
+	const sampleRate = 1000
+	// tempo track: 120 BPM, 60 BPM after the first quarter.
+	tempo := []byte{
+		0x00, 0xFF, 0x51, 0x03, 0x07, 0xA1, 0x20,
+		0x60, 0xFF, 0x51, 0x03, 0x0F, 0x42, 0x40,
+		0x60, 0xFF, 0x2F, 0x00,
+	}
+	notes := []byte{
+		0x00, 0x90, 60, 100,
+		// running status note off.
+		0x60, 60, 0,
+		0x00, 0xF0, 0x02, 0x01, 0xF7,
+		0x30, 0xC1, 5,
+		0x30, 0xFF, 0x2F, 0x00,
+	}
+
+	t.Run("format 1", func(t *testing.T) {
+		t.Parallel()
+		smf, err := vst2.ReadSMF(bytes.NewReader(smfFile(1, 96, tempo, notes)), sampleRate)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertEqual(t, "format", smf.Format, 1)
+		assertEqual(t, "tracks", smf.Tracks, 2)
+		assertEqual(t, "length", smf.Length, int64(1500))
+		assertEqual(t, "events", len(smf.Events), 3)
+		expected := []struct {
+			position int64
+			data     [3]byte
+		}{
+			{0, [3]byte{0x90, 60, 100}},
+			{500, [3]byte{0x90, 60, 0}},
+			{1000, [3]byte{0xC1, 5, 0}},
+		}
+		for i, e := range expected {
+			assertEqual(t, "position", smf.Events[i].Position, e.position)
+			assertEqual(t, "data", smf.Events[i].Event.(*vst2.MIDIEvent).Data, e.data)
+		}
+	})
+
+	t.Run("smpte", func(t *testing.T) {
+		t.Parallel()
+		// 25 fps, 40 ticks per frame is 1000 ticks per second.
+		smf, err := vst2.ReadSMF(bytes.NewReader(smfFile(0, 0xE728, notes)), 2*sampleRate)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertEqual(t, "length", smf.Length, int64(384))
+		assertEqual(t, "note off", smf.Events[1].Position, int64(192))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		if _, err := vst2.ReadSMF(bytes.NewReader(smfFile(2, 96, notes)), sampleRate); err == nil {
+			t.Fatal("expected error for format 2")
+		}
+		if _, err := vst2.ReadSMF(bytes.NewReader([]byte("MThd")), sampleRate); err == nil {
+			t.Fatal("expected error for truncated file")
+		}
+		if _, err := vst2.ReadSMF(bytes.NewReader(smfFile(0, 96, []byte{0x00, 60, 100})), sampleRate); err == nil {
+			t.Fatal("expected error for missing status")
+		}
+		if _, err := vst2.ReadSMF(bytes.NewReader(smfFile(0, 0x8028, notes)), sampleRate); err == nil {
+			t.Fatal("expected error for zero frame rate")
+		}
+		if _, err := vst2.ReadSMF(bytes.NewReader(smfFile(0, 96, []byte{0x00, 0xF0, 0x7F, 0xF7})), sampleRate); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected unexpected EOF for truncated sysex, got %v", err)
+		}
+		// header claims the maximum chunk length.
+		truncated := smfFile(0, 96, notes)
+		binary.BigEndian.PutUint32(truncated[18:], 0xFFFFFFFF)
+		if _, err := vst2.ReadSMF(bytes.NewReader(truncated), sampleRate); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected unexpected EOF for truncated chunk, got %v", err)
+		}
+	})
+}
+
+func TestMIDIRender(t *testing.T) {
+	path := skipIfNoPlugin(t)
+	v, err := vst2.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	render := vst2.MIDIRender{SampleRate: 44100, BufferSize: 256, TailHold: 100}
+	h := render.Host(vst2.Host{
+		CanDo: func(vst2.HostCanDoString) vst2.CanDoResponse {
+			return vst2.NoCanDo
+		},
+	})
+	assertEqual(t, "start stop process", h.CanDo(vst2.HostCanStartStopProcess), vst2.YesCanDo)
+	p := v.Plugin(h.Callback())
+	defer p.Close()
+	p.Start()
+	events := []vst2.TimedEvent{
+		{Position: 0, Event: vst2.NewMIDIEvent(0, vst2.NoteOn{Key: 60, Velocity: 100})},
+		{Position: 700, Event: vst2.NewMIDIEvent(0, vst2.NoteOff{Key: 60})},
+	}
+	var rendered int
+	err = render.Render(p, events, 1000, func(out vst2.DoubleBuffer) error {
+		rendered += out.Frames
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// effect without input has silent tail, it ends after hold.
+	assertEqual(t, "rendered", rendered, 1100)
+}
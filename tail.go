@@ -0,0 +1,61 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import "pipelined.dev/signal"
+
+// DefaultTailHold is the length of continuous silence in seconds that
+// ends the tail with unknown length.
+const DefaultTailHold = 0.3
+
+// tailDetector detects the end of tail with unknown length. Tail ends
+// after hold frames of continuous silence, so silent gaps shorter than
+// hold don't cut it off.
+type tailDetector struct {
+	threshold float64
+	hold      int64
+	// silent is the number of continuous silent frames.
+	silent int64
+}
+
+// newTailDetector returns detector with provided threshold and hold in
+// frames. DefaultTailThreshold and DefaultTailHold are used if they are
+// not positive.
+func newTailDetector(threshold float64, hold int, sampleRate signal.Frequency) tailDetector {
+	if threshold <= 0 {
+		threshold = DefaultTailThreshold
+	}
+	if hold <= 0 {
+		hold = int(DefaultTailHold * sampleRate)
+	}
+	if hold <= 0 {
+		hold = 1
+	}
+	return tailDetector{threshold: threshold, hold: int64(hold)}
+}
+
+// detect checks frames of the buffer starting at provided offset. If the
+// hold is complete, it returns the number of frames up to its end and
+// true.
+func (d *tailDetector) detect(b DoubleBuffer, offset, frames int) (int, bool) {
+	last := -1
+	for c := range b.data {
+		row := b.Channel(c)[offset : offset+frames]
+		for i := len(row) - 1; i > last; i-- {
+			if v := row[i]; v > d.threshold || v < -d.threshold {
+				last = i
+				break
+			}
+		}
+	}
+	if last >= 0 {
+		d.silent = int64(frames - last - 1)
+	} else {
+		d.silent += int64(frames)
+	}
+	if d.silent < d.hold {
+		return frames, false
+	}
+	return frames - int(d.silent-d.hold), true
+}
@@ -0,0 +1,43 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+import "testing"
+
+func TestTailDetector(t *testing.T) {
+	t.Parallel()
+	const frames = 8
+	b := NewDoubleBuffer(2, frames)
+	defer b.Free()
+	block := func(c int, samples ...float64) {
+		for i := range b.data {
+			zero(b.Channel(i))
+		}
+		copy(b.Channel(c), samples)
+	}
+
+	d := newTailDetector(0.1, 20, 44100)
+	block(0, 1)
+	n, done := d.detect(b, 0, frames)
+	assertEqual(t, "loud", done, false)
+	assertEqual(t, "loud frames", n, frames)
+	// silent gap is shorter than hold.
+	block(0)
+	_, done = d.detect(b, 0, frames)
+	assertEqual(t, "gap", done, false)
+	block(1, 0, 0, 0.5)
+	_, done = d.detect(b, 0, frames)
+	assertEqual(t, "after gap", done, false)
+	// 5 silent frames after the last loud one.
+	block(0)
+	n, done = d.detect(b, 0, frames)
+	assertEqual(t, "silent", done, false)
+	n, done = d.detect(b, 0, frames)
+	assertEqual(t, "done", done, true)
+	assertEqual(t, "hold end", n, 7)
+
+	d = newTailDetector(0, 0, 1000)
+	assertEqual(t, "default threshold", d.threshold, DefaultTailThreshold)
+	assertEqual(t, "default hold", d.hold, int64(300))
+}
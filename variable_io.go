@@ -0,0 +1,349 @@
+//go:build !plugin
+// +build !plugin
+
+package vst2
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"pipelined.dev/pipe"
+	"pipelined.dev/pipe/mutable"
+	"pipelined.dev/signal"
+)
+
+// varIOBlocks is the number of pipe buffers that variable I/O processor
+// can keep as unconsumed input.
+const varIOBlocks = 4
+
+type (
+	// variableIO matches the VstVariableIo structure.
+	variableIO struct {
+		inputs                    unsafe.Pointer
+		outputs                   unsafe.Pointer
+		numSamplesInput           int32
+		numSamplesOutput          int32
+		numSamplesInputProcessed  *int32
+		numSamplesOutputProcessed *int32
+	}
+
+	// VarIOProcessor is pipe component that hosts plugins that produce a
+	// different number of output frames than input frames, for example
+	// time-stretch and resampling plugins. Plugin output is buffered and
+	// emitted with the pipe buffer size. The line source must be wrapped
+	// with VarIOProcessor.Source to flush the buffered output after the
+	// input ends.
+	VarIOProcessor struct {
+		// SampleRate of the output. Input sample rate is used if zero.
+		SampleRate signal.Frequency
+		// Ratio is the expected number of output frames per input
+		// frame. It's used to size the plugin output buffer. If zero,
+		// ratio of sample rates is used.
+		Ratio float64
+		// MaxTail limits the number of frames produced after the input
+		// ends. DefaultMaxTail seconds are used if zero.
+		MaxTail int
+
+		plugin *Plugin
+		// inputLength is the number of input frames, set by the source
+		// when the input ends. Negative until then.
+		inputLength int64
+		// backlog is the number of buffered output frames.
+		backlog int64
+		// sent and processed count messages to let source wait for
+		// processor after the input ends.
+		mu        sync.Mutex
+		cond      *sync.Cond
+		sent      int64
+		processed int64
+	}
+
+	varIOEngine struct {
+		*VarIOProcessor
+		in, out FloatBuffer
+		// pending is the number of unconsumed frames in the input
+		// buffer.
+		pending int
+		// buffered holds plugin output per channel.
+		buffered [][]float64
+		position int64
+		// drained is the number of frames produced after the input
+		// ends.
+		drained int
+		maxTail int
+		inputs  int
+		outputs int
+	}
+)
+
+// ProcessVarIO processes input into output with variable number of frames.
+// Input frames are limited by in.Frames and output frames by out.Frames.
+// Returns the number of consumed input and produced output frames. Returns
+// false if plugin doesn't support variable I/O.
+func (p *Plugin) ProcessVarIO(in, out FloatBuffer) (int, int, bool) {
+	if p.varIO == nil {
+		// counters are stored right after the structure.
+		size := unsafe.Sizeof(variableIO{}) + 2*unsafe.Sizeof(int32(0))
+		mem := C.calloc(1, C.size_t(size))
+		p.varIO = (*variableIO)(mem)
+		p.varIO.numSamplesInputProcessed = (*int32)(unsafe.Pointer(uintptr(mem) + unsafe.Sizeof(variableIO{})))
+		p.varIO.numSamplesOutputProcessed = (*int32)(unsafe.Pointer(uintptr(mem) + unsafe.Sizeof(variableIO{}) + unsafe.Sizeof(int32(0))))
+	}
+	vio := p.varIO
+	vio.inputs = unsafe.Pointer(in.cArray())
+	vio.outputs = unsafe.Pointer(out.cArray())
+	vio.numSamplesInput = int32(in.Frames)
+	vio.numSamplesOutput = int32(out.Frames)
+	*vio.numSamplesInputProcessed = 0
+	*vio.numSamplesOutputProcessed = 0
+	if p.Dispatch(PlugProcessVarIo, 0, 0, unsafe.Pointer(vio), 0) == 0 {
+		return 0, 0, false
+	}
+	return int(*vio.numSamplesInputProcessed), int(*vio.numSamplesOutputProcessed), true
+}
+
+// freeVarIO frees the variable I/O structure.
+func (p *Plugin) freeVarIO() {
+	if p.varIO != nil {
+		C.free(unsafe.Pointer(p.varIO))
+		p.varIO = nil
+	}
+}
+
+// VarIOProcessor returns variable I/O processor for plugin. CanDo callback
+// reports start and stop process support.
+func (v *VST) VarIOProcessor(h Host) *VarIOProcessor {
+	processor := &VarIOProcessor{}
+	processor.cond = sync.NewCond(&processor.mu)
+	h.CanDo = supportCanDo(h.CanDo, HostCanStartStopProcess)
+	processor.plugin = v.Plugin(h.Callback())
+	return processor
+}
+
+// Source wraps the line source. After the input ends, it produces silent
+// buffers until processor emits the buffered output.
+func (p *VarIOProcessor) Source(fn pipe.SourceAllocatorFunc) pipe.SourceAllocatorFunc {
+	return func(mctx mutable.Context, bufferSize int) (pipe.Source, error) {
+		source, err := fn(mctx, bufferSize)
+		if err != nil {
+			return source, err
+		}
+		var (
+			sourceFn = source.SourceFunc
+			ended    bool
+			padded   bool
+			length   int64
+		)
+		source.SourceFunc = func(out signal.Floating) (int, error) {
+			if !ended {
+				read, err := sourceFn(out)
+				if err != io.EOF {
+					length += int64(read)
+					if err == nil {
+						p.send()
+					}
+					return read, err
+				}
+				ended = true
+				atomic.StoreInt64(&p.inputLength, length)
+			}
+			// the backlog is known only after processor is done
+			// with all sent buffers.
+			// at least one padding buffer is sent to drain plugin.
+			p.wait()
+			if padded && atomic.LoadInt64(&p.backlog) == 0 {
+				return 0, io.EOF
+			}
+			for i := 0; i < out.Len(); i++ {
+				out.SetSample(i, 0)
+			}
+			padded = true
+			p.send()
+			return out.Length(), nil
+		}
+		return source, nil
+	}
+}
+
+// Allocator returns pipe processor allocator that can be plugged into line.
+// Line channels must match plugin inputs.
+func (p *VarIOProcessor) Allocator(init ProcessorInitFunc) pipe.ProcessorAllocatorFunc {
+	return func(mctx mutable.Context, bufferSize int, props pipe.SignalProperties) (pipe.Processor, error) {
+		if props.Channels != p.plugin.NumInputs() {
+			return pipe.Processor{}, fmt.Errorf("line has %d channels, plugin has %d inputs", props.Channels, p.plugin.NumInputs())
+		}
+		sampleRate := p.SampleRate
+		if sampleRate == 0 {
+			sampleRate = props.SampleRate
+		}
+		ratio := p.Ratio
+		if ratio <= 0 {
+			ratio = float64(sampleRate) / float64(props.SampleRate)
+		}
+		p.plugin.Start()
+		p.plugin.SetSampleRate(props.SampleRate)
+		p.plugin.SetBufferSize(bufferSize)
+		if init != nil {
+			init(p.plugin)
+		}
+		e := p.engine(bufferSize, ratio, props.SampleRate)
+		return pipe.Processor{
+			SignalProperties: pipe.SignalProperties{
+				Channels:   e.outputs,
+				SampleRate: sampleRate,
+			},
+			StartFunc: func(context.Context) error {
+				p.plugin.Resume()
+				p.plugin.StartProcess()
+				return nil
+			},
+			ProcessFunc: e.process,
+			FlushFunc:   e.flush,
+		}, nil
+	}
+}
+
+func (p *VarIOProcessor) engine(bufferSize int, ratio float64, sampleRate signal.Frequency) *varIOEngine {
+	e := varIOEngine{
+		VarIOProcessor: p,
+		inputs:         p.plugin.NumInputs(),
+		outputs:        p.plugin.NumOutputs(),
+		maxTail:        p.MaxTail,
+	}
+	if e.maxTail <= 0 {
+		e.maxTail = int(DefaultMaxTail * sampleRate)
+	}
+	e.in = NewFloatBuffer(e.inputs, varIOBlocks*bufferSize)
+	e.out = NewFloatBuffer(e.outputs, int(math.Ceil(float64(bufferSize)*ratio))+bufferSize)
+	e.buffered = make([][]float64, e.outputs)
+	atomic.StoreInt64(&p.inputLength, -1)
+	atomic.StoreInt64(&p.backlog, 0)
+	p.mu.Lock()
+	p.sent, p.processed = 0, 0
+	p.mu.Unlock()
+	return &e
+}
+
+// process feeds the input into plugin and emits the buffered output.
+func (e *varIOEngine) process(in, out signal.Floating) (int, error) {
+	defer e.done()
+	frames := in.Length()
+	if length := atomic.LoadInt64(&e.inputLength); length >= 0 && e.position+int64(frames) > length {
+		// the rest of buffer is padding.
+		frames = int(length - e.position)
+		if frames < 0 {
+			frames = 0
+		}
+	}
+	e.position += int64(in.Length())
+	if e.pending+frames > e.in.Frames {
+		return 0, errors.New("plugin doesn't consume variable input")
+	}
+	for c := 0; c < e.inputs; c++ {
+		row := e.in.Channel(c)[e.pending : e.pending+frames]
+		idx, stride := channelIndex(in, c, 0)
+		for i := range row {
+			row[i] = float32(in.Sample(idx))
+			idx += stride
+		}
+	}
+	e.pending += frames
+	ended := frames < in.Length()
+	if err := e.feed(ended); err != nil {
+		return 0, err
+	}
+
+	emit := 0
+	if len(e.buffered) > 0 {
+		emit = min(len(e.buffered[0]), out.Length())
+	}
+	for c := range e.buffered {
+		writeChannel(out, c, 0, e.buffered[c][:emit])
+		n := copy(e.buffered[c], e.buffered[c][emit:])
+		e.buffered[c] = e.buffered[c][:n]
+	}
+	if len(e.buffered) > 0 {
+		atomic.StoreInt64(&e.backlog, int64(len(e.buffered[0])))
+	}
+	return emit, nil
+}
+
+// feed calls plugin until the input is consumed or plugin stops producing
+// output. After the input ends, plugin is drained until MaxTail.
+func (e *varIOEngine) feed(ended bool) error {
+	for {
+		if ended && e.drained >= e.maxTail {
+			return nil
+		}
+		input := e.in
+		input.Frames = e.pending
+		consumed, produced, ok := e.plugin.ProcessVarIO(input, e.out)
+		if !ok {
+			return errors.New("plugin doesn't support variable I/O")
+		}
+		if consumed > e.pending {
+			consumed = e.pending
+		}
+		if produced > e.out.Frames {
+			produced = e.out.Frames
+		}
+		for c := range e.buffered {
+			for _, v := range e.out.Channel(c)[:produced] {
+				e.buffered[c] = append(e.buffered[c], float64(v))
+			}
+		}
+		for c := 0; c < e.inputs; c++ {
+			row := e.in.Channel(c)
+			copy(row, row[consumed:e.pending])
+		}
+		e.pending -= consumed
+		if ended {
+			e.drained += produced
+		}
+		// plugin is stalled or waits for more input.
+		if consumed == 0 && produced == 0 || e.pending == 0 && produced < e.out.Frames {
+			return nil
+		}
+	}
+}
+
+func (e *varIOEngine) flush(context.Context) error {
+	e.in.Free()
+	e.out.Free()
+	e.plugin.StopProcess()
+	e.plugin.Suspend()
+	return nil
+}
+
+// send registers the buffer sent by source.
+func (p *VarIOProcessor) send() {
+	p.mu.Lock()
+	p.sent++
+	p.mu.Unlock()
+}
+
+// done registers the buffer processed by processor.
+func (p *VarIOProcessor) done() {
+	p.mu.Lock()
+	p.processed++
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// wait blocks until processor is done with all sent buffers.
+func (p *VarIOProcessor) wait() {
+	p.mu.Lock()
+	for p.processed < p.sent {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+}
@@ -457,6 +457,21 @@ const (
 	ProcessDouble
 )
 
+// PrecisionPolicy defines how the processing precision is negotiated with
+// plugin.
+type PrecisionPolicy int
+
+const (
+	// PreferDouble uses 64 bits processing if plugin supports it.
+	PreferDouble PrecisionPolicy = iota
+	// PreferFloat uses 32 bits processing if plugin supports it.
+	PreferFloat
+	// ForceDouble uses 64 bits processing regardless of plugin flags.
+	ForceDouble
+	// ForceFloat uses 32 bits processing regardless of plugin flags.
+	ForceFloat
+)
+
 // MIDIProgram describes the MIDI program.
 type MIDIProgram struct {
 	Index       int32